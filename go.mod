@@ -5,11 +5,18 @@ go 1.16
 require (
 	github.com/blang/semver v3.5.1+incompatible
 	github.com/bshuster-repo/logrus-logstash-hook v1.0.0 // indirect
-	github.com/containerd/containerd v1.5.4 // indirect
+	github.com/containerd/containerd v1.5.4
+	github.com/docker/cli v0.0.0-20200130152716-5d0cf8839492
+	github.com/joelanford/ignore v0.0.0-20210607151042-0d25dc18b62d
 	github.com/mattn/go-sqlite3 v1.14.7 // indirect
+	github.com/opencontainers/go-digest v1.0.0
+	github.com/opencontainers/image-spec v1.0.2-0.20190823105129-775207bd45b6
+	github.com/operator-framework/api v0.10.5
 	github.com/operator-framework/operator-registry v1.18.1-0.20210914133255-195bc038d915
 	github.com/sirupsen/logrus v1.8.1
 	github.com/spf13/cobra v1.1.3
+	google.golang.org/grpc v1.38.0
 	k8s.io/apimachinery v0.22.0
 	rsc.io/letsencrypt v0.0.3 // indirect
+	sigs.k8s.io/yaml v1.2.0
 )
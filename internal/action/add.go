@@ -3,9 +3,12 @@ package action
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
@@ -17,196 +20,369 @@ import (
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
+// PackageMetadata selects where the description and icon of a package come
+// from when bundles are added to it.
+type PackageMetadata string
+
+const (
+	// PackageMetadataFromHead takes the description and icon of the package
+	// from the head of its default channel when it is an added bundle, as in
+	// opm.
+	PackageMetadataFromHead PackageMetadata = "from-head"
+	// PackageMetadataKeep keeps the description and icon of existing
+	// packages. New packages still take them from the head of their default
+	// channel.
+	PackageMetadataKeep PackageMetadata = "keep"
+)
+
 type Add struct {
 	FromDir      string
 	BundleImages []string
 
+	// Channels and DefaultChannel, if set, override the channels and
+	// default channel declared in the metadata of the added bundles.
+	Channels       []string
+	DefaultChannel string
+	// PackageMetadata is the policy for the description and icon of the
+	// packages of the added bundles. It defaults to PackageMetadataFromHead.
+	PackageMetadata PackageMetadata
+	// channelsByImage overrides Channels for individual bundle images.
+	channelsByImage map[string][]string
+
 	OverwriteLatest bool
+	// OverwritePartialHeads extends OverwriteLatest to bundles that are the
+	// head of only some of their channels. Their entries in the other
+	// channels are kept.
+	OverwritePartialHeads bool
+	// PinDigests rewrites the bundle images and related images of the added
+	// bundles to digest references.
+	PinDigests bool
+	// Validators are the names of the validators run on the added bundles,
+	// DefaultValidators if empty. SkipValidation disables them.
+	Validators      []string
+	SkipValidation  bool
+	RegistryOptions RegistryOptions
+	LockTimeout     time.Duration
 	Log             *logrus.Logger
 }
 
-func (a Add) Run(ctx context.Context) error {
+func (a Add) Run(ctx context.Context) (*Result, error) {
 	if err := ensureDir(a.FromDir); err != nil {
-		return fmt.Errorf("ensure root declarative config directory %q: %v", a.FromDir, err)
+		return nil, fmt.Errorf("ensure root declarative config directory %q: %w", a.FromDir, err)
 	}
 
-	fbc, err := declcfg.LoadFS(os.DirFS(a.FromDir))
-	if err != nil {
-		return fmt.Errorf("load file-based catalog at %q: %v", a.FromDir, err)
-	}
-	m, err := declcfg.ConvertToModel(*fbc)
+	reg, err := newRegistry(a.RegistryOptions, a.Log)
 	if err != nil {
-		return fmt.Errorf("input file-based catalog at %q is invalid: %s", a.FromDir, err)
+		return nil, fmt.Errorf("create temporary image registry: %w", err)
 	}
+	defer destroyRegistry(reg, a.Log)
+
+	return mutateFBC(a.FromDir, a.LockTimeout, a.Log, func(fbc *declcfg.DeclarativeConfig) error {
+		return a.apply(ctx, reg, fbc)
+	})
+}
 
-	reg, err := newRegistry()
+func (a Add) apply(ctx context.Context, reg image.Registry, fbc *declcfg.DeclarativeConfig) error {
+	switch a.PackageMetadata {
+	case "", PackageMetadataFromHead, PackageMetadataKeep:
+	default:
+		return fmt.Errorf("unknown package metadata policy %q", a.PackageMetadata)
+	}
+	m, err := declcfg.ConvertToModel(*fbc)
 	if err != nil {
-		return fmt.Errorf("create temporary image registry: %v", err)
+		return fmt.Errorf("file-based catalog is invalid: %w", err)
 	}
-	defer destroyRegistry(reg, a.Log)
 
 	bundlesMap, err := a.loadBundles(ctx, reg, a.BundleImages)
 	if err != nil {
-		return fmt.Errorf("load bundles: %v", err)
+		return fmt.Errorf("load bundles: %w", err)
 	}
+	addedBundles := sets.NewString()
+	packageNames := []string{}
 	for packageName, bundles := range bundlesMap {
-		existingImages := sets.NewString()
-		bundleChannels := map[string][]string{}
-		pkg, ok := m[packageName]
-		if ok {
-			for _, ch := range pkg.Channels {
-				for _, b := range ch.Bundles {
-					bundleChannels[b.Name] = append(bundleChannels[b.Name], ch.Name)
-				}
-			}
-
-			for _, ch := range pkg.Channels {
-				for _, b := range ch.Bundles {
-					existingImages.Insert(b.Image)
-				}
-			}
+		for i := range bundles {
+			a.overrideChannels(&bundles[i])
+			addedBundles.Insert(bundles[i].Name)
 		}
-		pkgBundles, err := a.loadBundles(ctx, reg, existingImages.List())
-		if err != nil {
-			return fmt.Errorf("load images from existing bundles in package %q: %v", packageName, err)
-		}
-		packageBundles := map[string]*bundle{}
-		existingBundles := []*registry.Bundle{}
-		for _, b := range pkgBundles[packageName] {
-			b := b
-			b.Channels = bundleChannels[b.Name]
-			b.Annotations.Channels = strings.Join(b.Channels, ",")
-			packageBundles[b.Name] = &b
-			existingBundles = append(existingBundles, &b.Bundle)
-		}
-		nonChannelHeads := sets.NewString()
-		if len(existingBundles) > 0 {
-			existingPackageManifest, err := registry.SemverPackageManifest(existingBundles)
+		packageNames = append(packageNames, packageName)
+	}
+	sort.Strings(packageNames)
+	for _, packageName := range packageNames {
+		if err := a.addToPackage(fbc, m[packageName], packageName, bundlesMap[packageName]); err != nil {
+			return err
+		}
+	}
+	if a.PinDigests {
+		return pinBundles(ctx, a.RegistryOptions, a.Log, fbc, addedBundles)
+	}
+	return nil
+}
+
+// addToPackage inserts bundles into the existing channel graph of their
+// package, pkg, which is nil if the package is new. Entries, properties and
+// other blobs of the package that are unrelated to the added bundles are left
+// untouched.
+func (a Add) addToPackage(fbc *declcfg.DeclarativeConfig, pkg *model.Package, packageName string, bundles []bundle) error {
+	existingBundles := sets.NewString()
+	bundleChannels := map[string][]string{}
+	nonHeadChannels := map[string][]string{}
+	channelHeads := map[string]string{}
+	if pkg != nil {
+		for _, ch := range pkg.Channels {
+			head, err := ch.Head()
 			if err != nil {
-				return fmt.Errorf("get existing package manifest for package %q: %v", packageName, err)
+				return fmt.Errorf("get head of channel %q in package %q: %w", ch.Name, packageName, err)
 			}
-			for _, ch := range existingPackageManifest.Channels {
-				for _, b := range pkg.Channels[ch.Name].Bundles {
-					if b.Name != ch.CurrentCSVName {
-						nonChannelHeads.Insert(b.Name)
-					}
+			channelHeads[ch.Name] = head.Name
+			for _, b := range ch.Bundles {
+				existingBundles.Insert(b.Name)
+				bundleChannels[b.Name] = append(bundleChannels[b.Name], ch.Name)
+				if b != head {
+					nonHeadChannels[b.Name] = append(nonHeadChannels[b.Name], ch.Name)
 				}
 			}
 		}
+	}
+	heads := sets.NewString()
+	for _, head := range channelHeads {
+		heads.Insert(head)
+	}
 
-		if a.OverwriteLatest {
-			// make sure none of the bundles we're adding are found in the
-			// existing channels as non-channel-heads.
-			for _, b := range bundles {
-				if nonChannelHeads.Has(b.Name) {
-					return fmt.Errorf("cannot overwrite bundle %q: it is not exclusively a channel head", b.Name)
-				}
+	if a.OverwriteLatest {
+		// make sure none of the bundles we're adding are found in the
+		// existing channels as non-channel-heads, unless partial heads
+		// may be overwritten.
+		for i, b := range bundles {
+			channels := nonHeadChannels[b.Name]
+			if len(channels) == 0 {
+				continue
 			}
-		} else {
-			for _, b := range bundles {
-				if _, ok := packageBundles[b.Name]; ok {
-					return fmt.Errorf("bundle %q already present in package", b.Name)
-				}
+			if !a.OverwritePartialHeads || !heads.Has(b.Name) {
+				return classify(ErrBundleExists, fmt.Errorf("cannot overwrite bundle %q: it is not exclusively a channel head", b.Name))
 			}
+			sort.Strings(channels)
+			a.warnNonHeadEntries(pkg, b.Name, channels)
+			bundles[i].Channels = sets.NewString(b.Channels...).Insert(bundleChannels[b.Name]...).List()
+			bundles[i].Annotations.Channels = strings.Join(bundles[i].Channels, ",")
 		}
-
+	} else {
 		for _, b := range bundles {
-			b := b
-			packageBundles[b.Name] = &b
-		}
-		newRegistryBundles := []*registry.Bundle{}
-		subBundles := []*bundle{}
-		for _, b := range packageBundles {
-			if b.SubstitutesFor == "" {
-				newRegistryBundles = append(newRegistryBundles, &b.Bundle)
-			} else {
-				subBundles = append(subBundles, b)
+			if existingBundles.Has(b.Name) {
+				return classify(ErrBundleExists, fmt.Errorf("bundle %q already present in package", b.Name))
 			}
 		}
-		newPackageManifest, err := registry.SemverPackageManifest(newRegistryBundles)
+	}
+
+	// Insert the bundles in version order, so that each one can replace
+	// the previous one.
+	sort.SliceStable(bundles, func(i, j int) bool {
+		return bundles[i].Version.LT(bundles[j].Version)
+	})
+	subBundles := []*bundle{}
+	for i := range bundles {
+		b := &bundles[i]
+		if b.SubstitutesFor != "" {
+			subBundles = append(subBundles, b)
+			continue
+		}
+		setBundle(fbc, b.ToFBC())
+		a.addEntries(fbc, b, channelHeads)
+	}
+
+	if len(subBundles) > 0 {
+		subsByName := map[string]*bundle{}
+		for _, b := range subBundles {
+			subsByName[b.Name] = b
+		}
+		originals, chains, err := getSubsChains(subBundles)
 		if err != nil {
-			return fmt.Errorf("get existing package manifest for package %q: %v", packageName, err)
+			return fmt.Errorf("get substitution chains for package %q: %w", packageName, err)
 		}
-		defChHeadName := ""
-		for _, ch := range newPackageManifest.Channels {
-			if ch.Name == newPackageManifest.GetDefaultChannel() {
-				defChHeadName = ch.CurrentCSVName
-				break
+		for _, orig := range originals {
+			from, to := orig, chains[orig]
+			for to != "" {
+				setBundle(fbc, subsByName[to].ToFBC())
+				// An overwritten substitution keeps its existing entries.
+				if !existingBundles.Has(to) {
+					a.Log.WithFields(logrus.Fields{"package": packageName, "bundle": to, "substitutesFor": from}).Info("adding substitution")
+					addSubsFor(fbc, packageName, from, to)
+				}
+				to = chains[to]
 			}
 		}
-		icon := packageBundles[defChHeadName].Icon
-		pkg = &model.Package{
-			Name:        packageName,
-			Description: packageBundles[defChHeadName].Description,
-			Icon: &model.Icon{
-				Data:      icon.Data,
-				MediaType: icon.MediaType,
-			},
-			Channels: map[string]*model.Channel{},
-		}
-		for _, ch := range newPackageManifest.Channels {
-			mch := &model.Channel{
-				Package: pkg,
-				Name:    ch.Name,
-				Bundles: map[string]*model.Bundle{},
-			}
-			cur := packageBundles[ch.CurrentCSVName]
-			for cur != nil {
-				mch.Bundles[cur.Name] = cur.ToModel(pkg, mch)
-				cur = packageBundles[cur.Replaces]
-			}
-			pkg.Channels[ch.Name] = mch
-			if newPackageManifest.DefaultChannelName == mch.Name {
-				pkg.DefaultChannel = mch
-			}
+	}
+
+	if err := a.updatePackage(fbc, pkg, packageName, bundles); err != nil {
+		return err
+	}
+
+	// Only channel heads keep their objects.
+	heads = sets.NewString()
+	for _, ch := range fbc.Channels {
+		if ch.Package == packageName {
+			heads = heads.Union(entryHeads(ch))
+		}
+	}
+	for i, b := range fbc.Bundles {
+		if b.Package == packageName && !heads.Has(b.Name) && hasBundleObjects(b) {
+			fbc.Bundles[i].Properties = withoutBundleObjects(b.Properties)
+			fbc.Bundles[i].Objects = nil
 		}
+	}
+	return nil
+}
 
-		for _, ch := range pkg.Channels {
-			head, err := ch.Head()
-			if err != nil {
-				return fmt.Errorf("get head of channel %q in package %q: %v", ch.Name, packageName, err)
+// addEntries adds the entries of b to its channels, creating the channels
+// that do not exist yet. Bundles that b replaces are promoted to its channels
+// along with their replaces chain, as in the replaces mode of opm. An
+// overwritten bundle gets the upgrade edges of its new CSV in the channels it
+// is the head of, and keeps its entries in the other channels.
+func (a Add) addEntries(fbc *declcfg.DeclarativeConfig, b *bundle, channelHeads map[string]string) {
+	entry := declcfg.ChannelEntry{
+		Name:      b.Name,
+		Replaces:  b.Replaces,
+		Skips:     b.Skips,
+		SkipRange: b.SkipRange,
+	}
+	for _, chName := range b.Channels {
+		ch := findChannel(fbc.Channels, b.Package, chName)
+		if ch == nil {
+			a.Log.WithFields(logrus.Fields{"package": b.Package, "channel": chName}).Info("creating channel")
+			fbc.Channels = append(fbc.Channels, declcfg.Channel{
+				Schema:  "olm.channel",
+				Name:    chName,
+				Package: b.Package,
+			})
+			ch = &fbc.Channels[len(fbc.Channels)-1]
+		}
+		if i := entryIndex(*ch, b.Name); i >= 0 {
+			if channelHeads[chName] != b.Name {
+				continue
 			}
-			for _, b := range ch.Bundles {
-				if b != head {
-					tmpProperties := b.Properties[:0]
-					for _, p := range b.Properties {
-						if p.Type != property.TypeBundleObject {
-							tmpProperties = append(tmpProperties, p)
-						}
-					}
-					b.Properties = tmpProperties
-				}
+			ch.Entries[i] = entry
+		} else {
+			ch.Entries = append(ch.Entries, entry)
+		}
+
+		for replaces := b.Replaces; replaces != "" && !channelHasEntry(*ch, replaces); {
+			e, ok := findEntry(fbc.Channels, b.Package, replaces)
+			if !ok {
+				break
 			}
+			a.Log.WithFields(logrus.Fields{"package": b.Package, "channel": chName, "bundle": e.Name}).Info("promoting bundle")
+			ch.Entries = append(ch.Entries, e)
+			replaces = e.Replaces
 		}
+	}
+}
 
-		newM := model.Model{packageName: pkg}
-		if err := newM.Validate(); err != nil {
-			return fmt.Errorf("updated package %q is invalid: %v", packageName, err)
+// updatePackage creates the package blob of a new package, and otherwise
+// only updates the fields of the existing one that the added bundles
+// determine. As in opm, the default channel is the one declared by the
+// newest bundle of the package, including an overwritten one, and the
+// description and icon are those of the head of the default channel, unless
+// PackageMetadata keeps them.
+func (a Add) updatePackage(fbc *declcfg.DeclarativeConfig, pkg *model.Package, packageName string, bundles []bundle) error {
+	var p *declcfg.Package
+	for i := range fbc.Packages {
+		if fbc.Packages[i].Name == packageName {
+			p = &fbc.Packages[i]
 		}
-		pkgOut := declcfg.ConvertFromModel(newM)
+	}
+	if p == nil {
+		fbc.Packages = append(fbc.Packages, declcfg.Package{
+			Schema: "olm.package",
+			Name:   packageName,
+		})
+		p = &fbc.Packages[len(fbc.Packages)-1]
+	}
 
-		if len(subBundles) > 0 {
-			originals, chains, err := getSubsChains(subBundles)
-			if err != nil {
-				return fmt.Errorf("get substitution chains for package %q: %v", packageName, err)
+	latest := bundles[len(bundles)-1]
+	if a.DefaultChannel != "" {
+		p.DefaultChannel = a.DefaultChannel
+	} else if pkg == nil || latest.Version.GTE(latestVersion(pkg)) {
+		if dc := latest.Annotations.DefaultChannelName; dc != "" {
+			p.DefaultChannel = dc
+		} else if p.DefaultChannel == "" && len(latest.Channels) == 1 {
+			p.DefaultChannel = latest.Channels[0]
+		}
+	}
+
+	ch := findChannel(fbc.Channels, packageName, p.DefaultChannel)
+	if ch == nil {
+		return fmt.Errorf("default channel %q not found in package %q", p.DefaultChannel, packageName)
+	}
+	if pkg != nil && a.PackageMetadata == PackageMetadataKeep {
+		return nil
+	}
+	for _, b := range bundles {
+		if entryHeads(*ch).Has(b.Name) {
+			p.Description = b.Description
+			p.Icon = b.Icon
+		}
+	}
+	return nil
+}
+
+// warnNonHeadEntries warns about the entries of an overwritten bundle in
+// channels where it is not the head, as the entries that replace or skip it
+// there now lead to the new payload.
+func (a Add) warnNonHeadEntries(pkg *model.Package, name string, channels []string) {
+	for _, chName := range channels {
+		ch := pkg.Channels[chName]
+		var replacedBy []string
+		for _, b := range ch.Bundles {
+			if b.Replaces == name || sets.NewString(b.Skips...).Has(name) {
+				replacedBy = append(replacedBy, b.Name)
 			}
-			for _, orig := range originals {
-				from, to := orig, chains[orig]
-				for to != "" {
-					pkgOut.Bundles = append(pkgOut.Bundles, packageBundles[to].ToFBC())
-					a.Log.Infof("adding substitution: %q supercedes %q", to, from)
-					addSubsFor(&pkgOut, from, to)
-					to = chains[to]
-				}
+		}
+		sort.Strings(replacedBy)
+		var position []string
+		if replaces := ch.Bundles[name].Replaces; replaces != "" {
+			position = append(position, fmt.Sprintf("replaces %q", replaces))
+		}
+		if len(replacedBy) > 0 {
+			position = append(position, fmt.Sprintf("is replaced by %q", strings.Join(replacedBy, ", ")))
+		}
+		a.Log.WithFields(logrus.Fields{"package": pkg.Name, "bundle": name, "channel": chName}).Warnf(
+			"overwriting bundle %q, which is not the head of channel %q, where it %s", name, chName, strings.Join(position, " and "))
+	}
+}
+
+// pinBundles resolves the bundle images and related images of the named
+// bundles of fbc to digests.
+func pinBundles(ctx context.Context, opts RegistryOptions, log *logrus.Logger, fbc *declcfg.DeclarativeConfig, bundleNames sets.String) error {
+	resolver, err := newResolver(opts)
+	if err != nil {
+		return fmt.Errorf("create registry resolver: %w", err)
+	}
+	dr := newDigestResolver(resolver, opts, log)
+	for i, b := range fbc.Bundles {
+		if bundleNames.Has(b.Name) {
+			if err := dr.pinBundle(ctx, &fbc.Bundles[i]); err != nil {
+				return err
 			}
 		}
-		updateFBCPackage(fbc, pkgOut)
 	}
-	if _, err := declcfg.ConvertToModel(*fbc); err != nil {
-		return fmt.Errorf("updated file-based catalog is invalid: %v", err)
+	return nil
+}
+
+// overrideChannels replaces the channels and default channel declared in
+// the bundle's metadata with those requested by the user, if any.
+func (a Add) overrideChannels(b *bundle) {
+	channels := a.Channels
+	if c, ok := a.channelsByImage[b.BundleImage]; ok {
+		channels = c
+	}
+	if len(channels) > 0 {
+		a.Log.WithFields(logrus.Fields{"bundle": b.Name, "channels": channels}).Info("overriding channels of bundle")
+		b.Channels = channels
+		b.Annotations.Channels = strings.Join(channels, ",")
+	}
+	if a.DefaultChannel != "" {
+		a.Log.WithFields(logrus.Fields{"bundle": b.Name, "channel": a.DefaultChannel}).Info("overriding default channel of bundle")
+		b.Annotations.DefaultChannelName = a.DefaultChannel
 	}
-	a.Log.Infof("Writing updated file-based catalog")
-	return writeToFS(*fbc, a.FromDir, declcfg.WriteYAML)
 }
 
 type bundle struct {
@@ -226,12 +402,35 @@ type bundle struct {
 }
 
 func (a Add) loadBundles(ctx context.Context, reg image.Registry, bundleImages []string) (map[string][]bundle, error) {
+	validators := a.Validators
+	if len(validators) == 0 {
+		validators = DefaultValidators
+	}
+	if !a.SkipValidation {
+		if err := checkValidators(validators); err != nil {
+			return nil, err
+		}
+	}
+
 	bundlesMap := map[string][]bundle{}
+	var invalid []*bundleValidationError
 	for _, bi := range bundleImages {
-		a.Log.Infof("pulling bundle %q", bi)
-		rBundle, err := getRegistryBundle(ctx, reg, bi)
+		bi := bi
+		a.Log.WithField("image", bi).Info("pulling bundle")
+		var validate func(string, *registry.Bundle) error
+		if !a.SkipValidation {
+			validate = func(dir string, rBundle *registry.Bundle) error {
+				return validateBundle(bundleValidation{ctx: ctx, reg: reg, image: bi, dir: dir, bundle: rBundle, log: a.Log}, validators)
+			}
+		}
+		rBundle, err := getRegistryBundle(ctx, reg, bi, validate)
+		var verr *bundleValidationError
+		if errors.As(err, &verr) {
+			invalid = append(invalid, verr)
+			continue
+		}
 		if err != nil {
-			return nil, fmt.Errorf("get registry bundle for image %q: %v", bi, err)
+			return nil, fmt.Errorf("get registry bundle for image %q: %w", bi, err)
 		}
 		b, err := newBundle(rBundle)
 		if err != nil {
@@ -239,37 +438,46 @@ func (a Add) loadBundles(ctx context.Context, reg image.Registry, bundleImages [
 		}
 		bundlesMap[rBundle.Package] = append(bundlesMap[rBundle.Package], *b)
 	}
+	if len(invalid) > 0 {
+		// Report the problems of every bundle, not only the first one.
+		for _, verr := range invalid {
+			for _, p := range verr.problems {
+				a.Log.WithField("image", verr.image).Error(p)
+			}
+		}
+		return nil, classify(ErrInvalidBundle, fmt.Errorf("%d of %d bundles failed validation", len(invalid), len(bundleImages)))
+	}
 	return bundlesMap, nil
 }
 
 func newBundle(rBundle *registry.Bundle) (*bundle, error) {
 	version, err := rBundle.Version()
 	if err != nil {
-		return nil, fmt.Errorf("get version for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get version for bundle %q: %w", rBundle.Name, err)
 	}
 	semVersion, err := semver.Parse(version)
 	if err != nil {
-		return nil, fmt.Errorf("parse version %q for bundle %q as semver: %v", version, rBundle.Name, err)
+		return nil, fmt.Errorf("parse version %q for bundle %q as semver: %w", version, rBundle.Name, err)
 	}
 	replaces, err := rBundle.Replaces()
 	if err != nil {
-		return nil, fmt.Errorf("get replaces for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get replaces for bundle %q: %w", rBundle.Name, err)
 	}
 	skips, err := rBundle.Skips()
 	if err != nil {
-		return nil, fmt.Errorf("get skips for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get skips for bundle %q: %w", rBundle.Name, err)
 	}
 	skipRange, err := rBundle.SkipRange()
 	if err != nil {
-		return nil, fmt.Errorf("get skipRange for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get skipRange for bundle %q: %w", rBundle.Name, err)
 	}
 	subsFor, err := rBundle.SubstitutesFor()
 	if err != nil {
-		return nil, fmt.Errorf("get substitutesFor for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get substitutesFor for bundle %q: %w", rBundle.Name, err)
 	}
 	icons, err := rBundle.Icons()
 	if err != nil {
-		return nil, fmt.Errorf("get icons for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get icons for bundle %q: %w", rBundle.Name, err)
 	}
 	var icon *declcfg.Icon
 	if len(icons) > 0 && len(icons[0].Base64data) > 0 {
@@ -280,24 +488,24 @@ func newBundle(rBundle *registry.Bundle) (*bundle, error) {
 	}
 	desc, err := rBundle.Description()
 	if err != nil {
-		return nil, fmt.Errorf("get description for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get description for bundle %q: %w", rBundle.Name, err)
 	}
 
 	properties, err := registry.PropertiesFromBundle(rBundle)
 	if err != nil {
-		return nil, fmt.Errorf("get properties for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get properties for bundle %q: %w", rBundle.Name, err)
 	}
 
 	relatedImages, err := getRelatedImages(rBundle)
 	if err != nil {
-		return nil, fmt.Errorf("get related images for bundle %q: %v", rBundle.Name, err)
+		return nil, fmt.Errorf("get related images for bundle %q: %w", rBundle.Name, err)
 	}
 	objStrings := []string{}
 	csvJSON := ""
 	for _, obj := range rBundle.Objects {
 		data, err := json.Marshal(obj)
 		if err != nil {
-			return nil, fmt.Errorf("marshal object for bundle %q: %v", rBundle.Name, err)
+			return nil, fmt.Errorf("marshal object for bundle %q: %w", rBundle.Name, err)
 		}
 		objStrings = append(objStrings, string(data))
 		if obj.GroupVersionKind().Kind == "ClusterServiceVersion" {
@@ -336,38 +544,13 @@ func (b bundle) ToFBC() declcfg.Bundle {
 	}
 }
 
-func (b bundle) ToModel(pkg *model.Package, ch *model.Channel) *model.Bundle {
-	for _, obj := range b.ObjectStrings {
-		b.Properties = append(b.Properties, property.MustBuildBundleObjectData([]byte(obj)))
-	}
-	ri := []model.RelatedImage{}
-	for _, bri := range b.RelatedImages {
-		ri = append(ri, model.RelatedImage{
-			Name:  bri.Name,
-			Image: bri.Image,
-		})
-	}
-	return &model.Bundle{
-		Package:       pkg,
-		Channel:       ch,
-		Name:          b.Name,
-		Image:         b.BundleImage,
-		Replaces:      b.Replaces,
-		Skips:         b.Skips,
-		SkipRange:     b.SkipRange,
-		Properties:    b.Properties,
-		RelatedImages: ri,
-		Objects:       b.ObjectStrings,
-		CsvJSON:       b.CsvJSON,
-		PropertiesP:   nil,
-		Version:       b.Version,
-	}
-}
-
-func getRegistryBundle(ctx context.Context, reg image.Registry, img string) (*registry.Bundle, error) {
+// getRegistryBundle pulls img and parses the bundle it contains. If validate
+// is not nil, it is called with the directory the image is unpacked in and
+// the parsed bundle, and its error is returned as is.
+func getRegistryBundle(ctx context.Context, reg image.Registry, img string, validate func(dir string, b *registry.Bundle) error) (*registry.Bundle, error) {
 	ref := image.SimpleReference(img)
 	if err := reg.Pull(ctx, ref); err != nil {
-		return nil, err
+		return nil, classify(ErrPull, fmt.Errorf("pull %q: %w", img, err))
 	}
 	tmpDir, err := os.MkdirTemp("", "dcm-render-bundle-")
 	if err != nil {
@@ -382,6 +565,11 @@ func getRegistryBundle(ctx context.Context, reg image.Registry, img string) (*re
 	if err != nil {
 		return nil, err
 	}
+	if validate != nil {
+		if err := validate(tmpDir, ii.Bundle); err != nil {
+			return nil, err
+		}
+	}
 	return ii.Bundle, nil
 }
 
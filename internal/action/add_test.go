@@ -0,0 +1,272 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blang/semver"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/registry"
+	"github.com/sirupsen/logrus"
+)
+
+// testCatalog returns a catalog with package foo, whose channels are
+//
+//	stable: foo.v0.1.0 <- foo.v0.2.0
+//	fast:   foo.v0.1.0 <- foo.v0.2.0 <- foo.v0.3.0
+//
+// Every bundle carries a bundle object, as if it had been a channel head.
+func testCatalog() *declcfg.DeclarativeConfig {
+	fbc := &declcfg.DeclarativeConfig{
+		Packages: []declcfg.Package{{Schema: "olm.package", Name: "foo", DefaultChannel: "stable"}},
+		Channels: []declcfg.Channel{
+			{Schema: "olm.channel", Package: "foo", Name: "stable", Entries: []declcfg.ChannelEntry{
+				{Name: "foo.v0.1.0"},
+				{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+			}},
+			{Schema: "olm.channel", Package: "foo", Name: "fast", Entries: []declcfg.ChannelEntry{
+				{Name: "foo.v0.1.0"},
+				{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+				{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0"},
+			}},
+		},
+	}
+	for _, v := range []string{"0.1.0", "0.2.0", "0.3.0"} {
+		fbc.Bundles = append(fbc.Bundles, declcfg.Bundle{
+			Schema:  "olm.bundle",
+			Package: "foo",
+			Name:    "foo.v" + v,
+			Image:   "quay.io/example/foo-bundle:v" + v,
+			Properties: []property.Property{
+				property.MustBuildPackage("foo", v),
+				property.MustBuildBundleObjectData([]byte(`{"kind":"ConfigMap"}`)),
+			},
+		})
+	}
+	return fbc
+}
+
+// testBundle returns an added bundle of package foo.
+func testBundle(version string, channels []string, replaces string, skips []string, skipRange string) bundle {
+	return bundle{
+		Bundle: registry.Bundle{
+			Name:        "foo.v" + version,
+			Package:     "foo",
+			Channels:    channels,
+			BundleImage: "quay.io/example/foo-bundle:v" + version + "-new",
+			Annotations: &registry.Annotations{
+				PackageName: "foo",
+				Channels:    strings.Join(channels, ","),
+			},
+		},
+		Version:       semver.MustParse(version),
+		Replaces:      replaces,
+		Skips:         skips,
+		SkipRange:     skipRange,
+		Properties:    []property.Property{property.MustBuildPackage("foo", version)},
+		ObjectStrings: []string{`{"kind":"ConfigMap"}`},
+	}
+}
+
+func TestAddToPackage(t *testing.T) {
+	type spec struct {
+		name                  string
+		overwriteLatest       bool
+		overwritePartialHeads bool
+		bundle                bundle
+		defaultChannel        string
+		expectErr             error
+		// expectEntries are the expected entries of the channels that are
+		// checked, by channel name.
+		expectEntries        map[string][]declcfg.ChannelEntry
+		expectDefaultChannel string
+		// expectObjects are the bundles expected to keep bundle objects.
+		expectObjects []string
+	}
+	specs := []spec{
+		{
+			name:   "NewHead",
+			bundle: testBundle("0.4.0", []string{"fast"}, "foo.v0.3.0", nil, ""),
+			expectEntries: map[string][]declcfg.ChannelEntry{
+				"stable": {
+					{Name: "foo.v0.1.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+				},
+				"fast": {
+					{Name: "foo.v0.1.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+					{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0"},
+					{Name: "foo.v0.4.0", Replaces: "foo.v0.3.0"},
+				},
+			},
+			expectDefaultChannel: "stable",
+			expectObjects:        []string{"foo.v0.2.0", "foo.v0.4.0"},
+		},
+		{
+			name:   "NewChannelCopiesReplacesChain",
+			bundle: testBundle("0.4.0", []string{"candidate"}, "foo.v0.3.0", nil, ""),
+			expectEntries: map[string][]declcfg.ChannelEntry{
+				"candidate": {
+					{Name: "foo.v0.4.0", Replaces: "foo.v0.3.0"},
+					{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+					{Name: "foo.v0.1.0"},
+				},
+			},
+			expectDefaultChannel: "stable",
+			expectObjects:        []string{"foo.v0.2.0", "foo.v0.3.0", "foo.v0.4.0"},
+		},
+		{
+			name:   "SkipsAndSkipRange",
+			bundle: testBundle("0.4.0", []string{"stable"}, "foo.v0.2.0", []string{"foo.v0.3.0"}, ">=0.1.0 <0.4.0"),
+			expectEntries: map[string][]declcfg.ChannelEntry{
+				"stable": {
+					{Name: "foo.v0.1.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+					{Name: "foo.v0.4.0", Replaces: "foo.v0.2.0", Skips: []string{"foo.v0.3.0"}, SkipRange: ">=0.1.0 <0.4.0"},
+				},
+			},
+			expectDefaultChannel: "stable",
+			expectObjects:        []string{"foo.v0.3.0", "foo.v0.4.0"},
+		},
+		{
+			name:      "ExistingBundleWithoutOverwrite",
+			bundle:    testBundle("0.3.0", []string{"fast"}, "foo.v0.2.0", nil, ""),
+			expectErr: ErrBundleExists,
+		},
+		{
+			name:            "OverwriteExclusiveHead",
+			overwriteLatest: true,
+			bundle:          testBundle("0.3.0", []string{"fast"}, "foo.v0.2.0", nil, ">=0.1.0 <0.3.0"),
+			expectEntries: map[string][]declcfg.ChannelEntry{
+				"fast": {
+					{Name: "foo.v0.1.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+					{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0", SkipRange: ">=0.1.0 <0.3.0"},
+				},
+			},
+			expectDefaultChannel: "stable",
+			expectObjects:        []string{"foo.v0.2.0", "foo.v0.3.0"},
+		},
+		{
+			name:                  "OverwritePartialHead",
+			overwriteLatest:       true,
+			overwritePartialHeads: true,
+			bundle:                testBundle("0.2.0", []string{"stable"}, "foo.v0.1.0", nil, ">=0.1.0 <0.2.0"),
+			expectEntries: map[string][]declcfg.ChannelEntry{
+				"stable": {
+					{Name: "foo.v0.1.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0", SkipRange: ">=0.1.0 <0.2.0"},
+				},
+				// The entry where the bundle is not the head is kept.
+				"fast": {
+					{Name: "foo.v0.1.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+					{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0"},
+				},
+			},
+			expectDefaultChannel: "stable",
+			expectObjects:        []string{"foo.v0.2.0", "foo.v0.3.0"},
+		},
+		{
+			name:            "RejectPartialHeadWithoutFlag",
+			overwriteLatest: true,
+			bundle:          testBundle("0.2.0", []string{"stable"}, "foo.v0.1.0", nil, ""),
+			expectErr:       ErrBundleExists,
+		},
+		{
+			name:                  "RejectNonHead",
+			overwriteLatest:       true,
+			overwritePartialHeads: true,
+			bundle:                testBundle("0.1.0", []string{"stable"}, "", nil, ""),
+			expectErr:             ErrBundleExists,
+		},
+		{
+			name:            "OverwriteNewestChangesDefaultChannel",
+			overwriteLatest: true,
+			bundle:          testBundle("0.3.0", []string{"fast"}, "foo.v0.2.0", nil, ""),
+			defaultChannel:  "fast",
+			expectEntries: map[string][]declcfg.ChannelEntry{
+				"fast": {
+					{Name: "foo.v0.1.0"},
+					{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+					{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0"},
+				},
+			},
+			expectDefaultChannel: "fast",
+			expectObjects:        []string{"foo.v0.2.0", "foo.v0.3.0"},
+		},
+		{
+			name:           "OlderBundleKeepsDefaultChannel",
+			bundle:         testBundle("0.2.5", []string{"candidate"}, "foo.v0.1.0", nil, ""),
+			defaultChannel: "candidate",
+			expectEntries: map[string][]declcfg.ChannelEntry{
+				"candidate": {
+					{Name: "foo.v0.2.5", Replaces: "foo.v0.1.0"},
+					{Name: "foo.v0.1.0"},
+				},
+			},
+			expectDefaultChannel: "stable",
+			expectObjects:        []string{"foo.v0.2.0", "foo.v0.3.0", "foo.v0.2.5"},
+		},
+	}
+
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			fbc := testCatalog()
+			m, err := declcfg.ConvertToModel(*fbc)
+			if err != nil {
+				t.Fatalf("convert test catalog: %v", err)
+			}
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+			a := Add{
+				OverwriteLatest:       s.overwriteLatest,
+				OverwritePartialHeads: s.overwritePartialHeads,
+				Log:                   log,
+			}
+			b := s.bundle
+			b.Annotations.DefaultChannelName = s.defaultChannel
+
+			err = a.addToPackage(fbc, m["foo"], "foo", []bundle{b})
+			if s.expectErr != nil {
+				if !errors.Is(err, s.expectErr) {
+					t.Fatalf("expected error %v, got %v", s.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := validateFBC(*fbc); err != nil {
+				t.Fatalf("result is invalid: %v", err)
+			}
+
+			for chName, expected := range s.expectEntries {
+				ch := findChannel(fbc.Channels, "foo", chName)
+				if ch == nil {
+					t.Fatalf("channel %q not found", chName)
+				}
+				if !reflect.DeepEqual(ch.Entries, expected) {
+					t.Errorf("entries of channel %q:\nexpected %+v\ngot      %+v", chName, expected, ch.Entries)
+				}
+			}
+			if dc := fbc.Packages[0].DefaultChannel; dc != s.expectDefaultChannel {
+				t.Errorf("expected default channel %q, got %q", s.expectDefaultChannel, dc)
+			}
+			var withObjects []string
+			for _, b := range fbc.Bundles {
+				if hasBundleObjects(b) {
+					withObjects = append(withObjects, b.Name)
+				}
+			}
+			if !reflect.DeepEqual(withObjects, s.expectObjects) {
+				t.Errorf("expected bundles with objects %v, got %v", s.expectObjects, withObjects)
+			}
+		})
+	}
+}
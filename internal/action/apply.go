@@ -0,0 +1,243 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+// Plan is an ordered list of operations applied to a declarative config
+// directory as a single transaction.
+type Plan struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+// PlanStep is a single operation of a plan. Exactly one of its fields must
+// be set.
+type PlanStep struct {
+	Add               *AddStep               `json:"add,omitempty"`
+	Deprecate         *DeprecateStep         `json:"deprecate,omitempty"`
+	Remove            *RemoveStep            `json:"remove,omitempty"`
+	Promote           *PromoteStep           `json:"promote,omitempty"`
+	SetDefaultChannel *SetDefaultChannelStep `json:"setDefaultChannel,omitempty"`
+	RenameChannel     *RenameChannelStep     `json:"renameChannel,omitempty"`
+	RemoveChannel     *RemoveChannelStep     `json:"removeChannel,omitempty"`
+}
+
+// AddStep adds bundle images, like the add command.
+type AddStep struct {
+	Bundles               []string `json:"bundles"`
+	Channels              []string `json:"channels,omitempty"`
+	DefaultChannel        string   `json:"defaultChannel,omitempty"`
+	PackageMetadata       string   `json:"packageMetadata,omitempty"`
+	OverwriteLatest       bool     `json:"overwriteLatest,omitempty"`
+	OverwritePartialHeads bool     `json:"overwritePartialHeads,omitempty"`
+	PinDigests            bool     `json:"pinDigests,omitempty"`
+	Validators            []string `json:"validators,omitempty"`
+	SkipValidation        bool     `json:"skipValidation,omitempty"`
+}
+
+// DeprecateStep deprecates bundle images and truncates their replaces
+// chains, like the deprecatetruncate command.
+type DeprecateStep struct {
+	Bundles []string `json:"bundles"`
+}
+
+// RemoveStep removes bundles, by name or image, from every channel of their
+// package and from the catalog.
+type RemoveStep struct {
+	Bundles []string `json:"bundles"`
+}
+
+// PromoteStep promotes a bundle to another channel, like the channel promote
+// command.
+type PromoteStep struct {
+	Bundle      string `json:"bundle"`
+	FromChannel string `json:"fromChannel,omitempty"`
+	ToChannel   string `json:"toChannel"`
+}
+
+// SetDefaultChannelStep sets the default channel of a package.
+type SetDefaultChannelStep struct {
+	Package string `json:"package"`
+	Channel string `json:"channel"`
+}
+
+// RenameChannelStep renames a channel of a package.
+type RenameChannelStep struct {
+	Package string `json:"package"`
+	Channel string `json:"channel"`
+	NewName string `json:"newName"`
+}
+
+// RemoveChannelStep removes a channel from a package.
+type RemoveChannelStep struct {
+	Package string `json:"package"`
+	Channel string `json:"channel"`
+}
+
+// LoadPlan reads a plan from a YAML or JSON file.
+func LoadPlan(filename string) (*Plan, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read plan: %w", err)
+	}
+	var plan Plan
+	if err := yaml.UnmarshalStrict(data, &plan); err != nil {
+		return nil, fmt.Errorf("parse plan %q: %w", filename, err)
+	}
+	return &plan, nil
+}
+
+// Apply runs the steps of a plan against a declarative config directory.
+// The steps are applied in order to a single in-memory catalog, which is
+// validated and written once at the end. If any step fails, the directory is
+// left untouched.
+type Apply struct {
+	FromDir string
+	Plan    Plan
+
+	RegistryOptions RegistryOptions
+	LockTimeout     time.Duration
+	Log             *logrus.Logger
+}
+
+func (a Apply) Run(ctx context.Context) (*Result, error) {
+	if err := ensureDir(a.FromDir); err != nil {
+		return nil, fmt.Errorf("ensure root declarative config directory %q: %w", a.FromDir, err)
+	}
+
+	// The registry is only needed by add steps, and is created on first use.
+	var reg image.Registry
+	defer func() {
+		if reg != nil {
+			destroyRegistry(reg, a.Log)
+		}
+	}()
+
+	return mutateFBC(a.FromDir, a.LockTimeout, a.Log, func(fbc *declcfg.DeclarativeConfig) error {
+		for i, step := range a.Plan.Steps {
+			if step.Add != nil && reg == nil {
+				var err error
+				if reg, err = newRegistry(a.RegistryOptions, a.Log); err != nil {
+					return fmt.Errorf("create temporary image registry: %w", err)
+				}
+			}
+			if err := a.applyStep(ctx, reg, fbc, step); err != nil {
+				return fmt.Errorf("step %d: %w", i+1, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (a Apply) applyStep(ctx context.Context, reg image.Registry, fbc *declcfg.DeclarativeConfig, step PlanStep) error {
+	var (
+		apply func(*declcfg.DeclarativeConfig) error
+		n     int
+	)
+	if s := step.Add; s != nil {
+		n++
+		a.Log.WithField("images", s.Bundles).Info("adding bundles")
+		add := Add{
+			BundleImages:          s.Bundles,
+			Channels:              s.Channels,
+			DefaultChannel:        s.DefaultChannel,
+			PackageMetadata:       PackageMetadata(s.PackageMetadata),
+			OverwriteLatest:       s.OverwriteLatest,
+			OverwritePartialHeads: s.OverwritePartialHeads,
+			PinDigests:            s.PinDigests,
+			Validators:            s.Validators,
+			SkipValidation:        s.SkipValidation,
+			RegistryOptions:       a.RegistryOptions,
+			Log:                   a.Log,
+		}
+		apply = func(fbc *declcfg.DeclarativeConfig) error {
+			return add.apply(ctx, reg, fbc)
+		}
+	}
+	if s := step.Deprecate; s != nil {
+		n++
+		a.Log.WithField("images", s.Bundles).Info("deprecating bundles")
+		apply = DeprecateTruncate{BundleImages: s.Bundles, Log: a.Log}.apply
+	}
+	if s := step.Remove; s != nil {
+		n++
+		apply = removeBundles{bundles: s.Bundles, log: a.Log}.apply
+	}
+	if s := step.Promote; s != nil {
+		n++
+		apply = ChannelPromote{Bundle: s.Bundle, FromChannel: s.FromChannel, ToChannel: s.ToChannel, Log: a.Log}.apply
+	}
+	if s := step.SetDefaultChannel; s != nil {
+		n++
+		apply = ChannelSetDefault{Package: s.Package, Channel: s.Channel, Log: a.Log}.apply
+	}
+	if s := step.RenameChannel; s != nil {
+		n++
+		apply = ChannelRename{Package: s.Package, Channel: s.Channel, NewName: s.NewName, Log: a.Log}.apply
+	}
+	if s := step.RemoveChannel; s != nil {
+		n++
+		apply = ChannelRemove{Package: s.Package, Channel: s.Channel, Log: a.Log}.apply
+	}
+	if n != 1 {
+		return fmt.Errorf("expected exactly one operation, found %d", n)
+	}
+	return apply(fbc)
+}
+
+// removeBundles removes bundles from every channel of their package, and
+// from the catalog. Channels left without entries are removed.
+type removeBundles struct {
+	bundles []string
+	log     *logrus.Logger
+}
+
+func (r removeBundles) apply(fbc *declcfg.DeclarativeConfig) error {
+	removed := map[string]sets.String{}
+	for _, nameOrImage := range r.bundles {
+		b, err := findBundle(fbc.Bundles, nameOrImage)
+		if err != nil {
+			return err
+		}
+		r.log.WithFields(logrus.Fields{"package": b.Package, "bundle": b.Name}).Info("removing bundle")
+		if removed[b.Package] == nil {
+			removed[b.Package] = sets.NewString()
+		}
+		removed[b.Package].Insert(b.Name)
+	}
+
+	tmpChannels := fbc.Channels[:0]
+	for _, ch := range fbc.Channels {
+		tmpEntries := ch.Entries[:0]
+		for _, e := range ch.Entries {
+			if !removed[ch.Package].Has(e.Name) {
+				tmpEntries = append(tmpEntries, e)
+			}
+		}
+		ch.Entries = tmpEntries
+		if len(ch.Entries) == 0 {
+			r.log.WithFields(logrus.Fields{"package": ch.Package, "channel": ch.Name}).Info("removing channel: it has no remaining entries")
+			continue
+		}
+		tmpChannels = append(tmpChannels, ch)
+	}
+	fbc.Channels = tmpChannels
+
+	tmpBundles := fbc.Bundles[:0]
+	for _, b := range fbc.Bundles {
+		if !removed[b.Package].Has(b.Name) {
+			tmpBundles = append(tmpBundles, b)
+		}
+	}
+	fbc.Bundles = tmpBundles
+	return nil
+}
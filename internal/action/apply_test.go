@@ -0,0 +1,117 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/sirupsen/logrus"
+)
+
+// readTree returns the contents of the files of dir that are not hidden, by
+// path relative to dir.
+func readTree(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	for _, f := range listTree(t, dir) {
+		if isHidden(f) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f] = string(data)
+	}
+	return files
+}
+
+func TestApply(t *testing.T) {
+	type spec struct {
+		name        string
+		steps       []PlanStep
+		expectErr   bool
+		expectClass error
+		// check checks the written catalog, when the plan succeeds.
+		check func(t *testing.T, fbc *declcfg.DeclarativeConfig)
+	}
+	specs := []spec{
+		{
+			name: "AllSteps",
+			steps: []PlanStep{
+				{Promote: &PromoteStep{Bundle: "foo.v0.3.0", ToChannel: "candidate"}},
+				{SetDefaultChannel: &SetDefaultChannelStep{Package: "foo", Channel: "candidate"}},
+				{RemoveChannel: &RemoveChannelStep{Package: "foo", Channel: "stable"}},
+			},
+			check: func(t *testing.T, fbc *declcfg.DeclarativeConfig) {
+				if dc := fbc.Packages[0].DefaultChannel; dc != "candidate" {
+					t.Errorf("expected default channel candidate, got %q", dc)
+				}
+				if findChannel(fbc.Channels, "foo", "stable") != nil {
+					t.Errorf("expected channel stable to be removed")
+				}
+			},
+		},
+		{
+			name: "FailingStepRollsBack",
+			steps: []PlanStep{
+				{Promote: &PromoteStep{Bundle: "foo.v0.3.0", ToChannel: "candidate"}},
+				{RemoveChannel: &RemoveChannelStep{Package: "foo", Channel: "beta"}},
+			},
+			expectClass: ErrInvalidInput,
+		},
+		{
+			name: "InvalidResultRollsBack",
+			steps: []PlanStep{
+				{Remove: &RemoveStep{Bundles: []string{"foo.v0.2.0"}}},
+			},
+			expectClass: ErrInvalidResult,
+		},
+		{
+			name: "StepWithTwoOperations",
+			steps: []PlanStep{
+				{
+					SetDefaultChannel: &SetDefaultChannelStep{Package: "foo", Channel: "fast"},
+					RemoveChannel:     &RemoveChannelStep{Package: "foo", Channel: "stable"},
+				},
+			},
+			expectErr: true,
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := writeToFS(*testCatalog(), dir, declcfg.WriteYAML); err != nil {
+				t.Fatal(err)
+			}
+			before := readTree(t, dir)
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+			a := Apply{FromDir: dir, Plan: Plan{Steps: s.steps}, Log: log}
+
+			_, err := a.Run(context.Background())
+			if s.expectClass != nil || s.expectErr {
+				if err == nil || (s.expectClass != nil && !errors.Is(err, s.expectClass)) {
+					t.Fatalf("expected error %v, got %v", s.expectClass, err)
+				}
+				if after := readTree(t, dir); !reflect.DeepEqual(after, before) {
+					t.Errorf("catalog changed by a failed plan:\nbefore %v\nafter  %v", before, after)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			fbc, err := loadFBC(dir)
+			if err != nil {
+				t.Fatalf("load written catalog: %v", err)
+			}
+			s.check(t, fbc)
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package action
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/operator-framework/operator-registry/alpha/action"
+	"github.com/operator-framework/operator-registry/pkg/containertools"
+	"github.com/sirupsen/logrus"
+)
+
+// configsDir is the location of the declarative config root in index images.
+const configsDir = "/configs"
+
+// GenerateDockerfile writes a Dockerfile that builds an index image from a
+// declarative config directory. The Dockerfile is written next to the
+// directory, as <dcDir>.Dockerfile, along with a <dcDir>.Dockerfile.dockerignore
+// file that excludes the catalog lock file from the image, as BuildOCILayout
+// does.
+type GenerateDockerfile struct {
+	FromDir     string
+	BaseImage   string
+	ExtraLabels map[string]string
+	// Overwrite allows replacing an existing Dockerfile.
+	Overwrite bool
+
+	Log *logrus.Logger
+}
+
+func (g GenerateDockerfile) Run(_ context.Context) (*Result, error) {
+	if _, err := loadModel(g.FromDir); err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Clean(g.FromDir)
+	filename := filepath.Join(filepath.Dir(dir), filepath.Base(dir)+".Dockerfile")
+	ignoreFilename := filename + ".dockerignore"
+	if !g.Overwrite {
+		for _, f := range []string{filename, ignoreFilename} {
+			if _, err := os.Lstat(f); err == nil {
+				return nil, classify(ErrOutputNotEmpty, fmt.Errorf("file %q already exists", f))
+			} else if !os.IsNotExist(err) {
+				return nil, err
+			}
+		}
+	}
+	var buf bytes.Buffer
+	gen := action.GenerateDockerfile{
+		BaseImage:   g.BaseImage,
+		IndexDir:    filepath.Base(dir),
+		ExtraLabels: g.ExtraLabels,
+		Writer:      &buf,
+	}
+	if err := gen.Run(); err != nil {
+		return nil, fmt.Errorf("generate Dockerfile: %w", err)
+	}
+	g.Log.WithField("file", filename).Info("writing Dockerfile")
+	if err := writeRawFile(filename, buf.Bytes()); err != nil {
+		return nil, err
+	}
+	// The build context is the parent of the directory.
+	ignore := fmt.Sprintf("%[1]s/%[2]s\n%[1]s/%[3]s*\n", filepath.Base(dir), catalogLockFile, stagingPrefix)
+	if err := writeRawFile(ignoreFilename, []byte(ignore)); err != nil {
+		return nil, err
+	}
+	return &Result{FilesWritten: []string{filename, ignoreFilename}}, nil
+}
+
+// BuildOCILayout builds an index image containing a declarative config
+// directory, and writes it as an OCI image layout. The image consists of a
+// single layer with the declarative config root at /configs; it has no base
+// image, and no daemon or registry is needed to build it. As it contains no
+// binaries, it has no entrypoint and cannot be run on its own.
+type BuildOCILayout struct {
+	FromDir   string
+	OutputDir string
+	// Tag is recorded as the reference name of the image in the layout's
+	// index.
+	Tag         string
+	ExtraLabels map[string]string
+
+	Log *logrus.Logger
+}
+
+func (b BuildOCILayout) Run(_ context.Context) (*Result, error) {
+	if _, err := loadModel(b.FromDir); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(b.OutputDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read output directory %q: %w", b.OutputDir, err)
+	}
+	if len(entries) > 0 {
+		return nil, classify(ErrOutputNotEmpty, fmt.Errorf("output directory %q is not empty", b.OutputDir))
+	}
+	blobsDir := filepath.Join(b.OutputDir, "blobs", digest.Canonical.String())
+	if err := os.MkdirAll(blobsDir, 0777); err != nil {
+		return nil, fmt.Errorf("create blobs directory: %w", err)
+	}
+
+	layer, diffID, err := configsLayer(b.FromDir)
+	if err != nil {
+		return nil, fmt.Errorf("create configs layer: %w", err)
+	}
+	layerDesc, err := writeBlob(blobsDir, ocispec.MediaTypeImageLayerGzip, layer)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := map[string]string{}
+	for k, v := range b.ExtraLabels {
+		labels[k] = v
+	}
+	labels[containertools.ConfigsLocationLabel] = configsDir
+	config, err := json.Marshal(ocispec.Image{
+		Architecture: "amd64",
+		OS:           "linux",
+		Config: ocispec.ImageConfig{
+			Labels: labels,
+		},
+		RootFS: ocispec.RootFS{
+			Type:    "layers",
+			DiffIDs: []digest.Digest{diffID},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal image config: %w", err)
+	}
+	configDesc, err := writeBlob(blobsDir, ocispec.MediaTypeImageConfig, config)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    configDesc,
+		Layers:    []ocispec.Descriptor{layerDesc},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal image manifest: %w", err)
+	}
+	manifestDesc, err := writeBlob(blobsDir, ocispec.MediaTypeImageManifest, manifest)
+	if err != nil {
+		return nil, err
+	}
+	if b.Tag != "" {
+		manifestDesc.Annotations = map[string]string{ocispec.AnnotationRefName: b.Tag}
+	}
+
+	index, err := json.Marshal(ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: []ocispec.Descriptor{manifestDesc},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("marshal image index: %w", err)
+	}
+	layout, err := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	if err != nil {
+		return nil, fmt.Errorf("marshal image layout: %w", err)
+	}
+	layoutFile := filepath.Join(b.OutputDir, ocispec.ImageLayoutFile)
+	if err := writeRawFile(layoutFile, layout); err != nil {
+		return nil, err
+	}
+	indexFile := filepath.Join(b.OutputDir, "index.json")
+	if err := writeRawFile(indexFile, index); err != nil {
+		return nil, err
+	}
+	b.Log.WithFields(logrus.Fields{"digest": manifestDesc.Digest, "dir": b.OutputDir}).Info("wrote image to OCI layout")
+	res := &Result{FilesWritten: []string{layoutFile, indexFile}}
+	for _, desc := range []ocispec.Descriptor{layerDesc, configDesc, manifestDesc} {
+		res.FilesWritten = append(res.FilesWritten, filepath.Join(blobsDir, desc.Digest.Hex()))
+	}
+	return res, nil
+}
+
+// configsLayer returns a gzipped tar layer containing the files of dir under
+// the configs directory, along with the digest of the uncompressed tar. The
+// layer is reproducible: file ownership and modification times are not
+// recorded.
+func configsLayer(dir string) ([]byte, digest.Digest, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == filepath.Join(dir, catalogLockFile) {
+			return nil
+		}
+		if d.IsDir() && filepath.Dir(path) == dir && strings.HasPrefix(d.Name(), stagingPrefix) {
+			return fs.SkipDir
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	digester := digest.Canonical.Digester()
+	tw := tar.NewWriter(io.MultiWriter(gz, digester.Hash()))
+	for _, path := range paths {
+		if err := addToLayer(tw, dir, path); err != nil {
+			return nil, "", err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), digester.Digest(), nil
+}
+
+func addToLayer(tw *tar.Writer, root, path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() && !info.Mode().IsRegular() {
+		return fmt.Errorf("unsupported file type for %q: only regular files and directories are allowed", path)
+	}
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = filepath.ToSlash(filepath.Join(configsDir[1:], rel))
+	if info.IsDir() {
+		hdr.Name += "/"
+	}
+	hdr.Uid, hdr.Gid = 0, 0
+	hdr.Uname, hdr.Gname = "", ""
+	hdr.ModTime = time.Unix(0, 0)
+	hdr.AccessTime, hdr.ChangeTime = time.Time{}, time.Time{}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+func writeBlob(blobsDir, mediaType string, data []byte) (ocispec.Descriptor, error) {
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.Canonical.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+	if err := writeRawFile(filepath.Join(blobsDir, desc.Digest.Hex()), data); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	return desc, nil
+}
@@ -0,0 +1,487 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/containerd/containerd/remotes"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+const (
+	cacheLockFile   = "cache.lock"
+	cacheEntriesDir = "entries"
+	cacheStagingDir = "staging"
+	cacheContentDir = "content"
+	cacheEntryFile  = "entry.json"
+)
+
+// CacheList lists the entries of a persistent image cache.
+type CacheList struct {
+	Dir string
+	// JSON writes the entries as JSON instead of a table.
+	JSON   bool
+	Writer io.Writer
+}
+
+func (l CacheList) Run(_ context.Context) error {
+	c, err := openExistingImageCache(l.Dir, 0)
+	if err != nil {
+		return err
+	}
+	var entries []imageCacheEntry
+	if c != nil {
+		unlock, err := c.lock(false)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+
+		if entries, err = c.entries(); err != nil {
+			return err
+		}
+	}
+	if l.JSON {
+		if entries == nil {
+			entries = []imageCacheEntry{}
+		}
+		enc := json.NewEncoder(l.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	tw := tabwriter.NewWriter(l.Writer, 0, 4, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "DIGEST\tSIZE\tLAST USED\tREFERENCES"); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		size := resource.NewQuantity(e.Size, resource.BinarySI)
+		if _, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", e.Digest, size, e.LastUsed.Format(time.RFC3339), strings.Join(e.Refs, ",")); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// CachePrune removes entries from a persistent image cache. Entries that have
+// not been used for longer than UnusedFor are removed first, after which the
+// least recently used entries are evicted until the cache fits in MaxSize.
+// If neither limit is set, the cache is emptied.
+type CachePrune struct {
+	Dir       string
+	MaxSize   int64
+	UnusedFor time.Duration
+
+	Log *logrus.Logger
+}
+
+func (p CachePrune) Run(_ context.Context) (*Result, error) {
+	c, err := openExistingImageCache(p.Dir, p.MaxSize)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return &Result{}, nil
+	}
+	unlock, err := c.lock(true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	res := &Result{}
+	if p.MaxSize == 0 && p.UnusedFor == 0 {
+		p.Log.WithField("dir", p.Dir).Info("removing all entries from image cache")
+		entries, err := c.entries()
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if err := c.remove(e); err != nil {
+				return nil, err
+			}
+			res.RemovedImages = append(res.RemovedImages, e.Digest)
+		}
+		return res, nil
+	}
+
+	if p.UnusedFor > 0 {
+		entries, err := c.entries()
+		if err != nil {
+			return nil, err
+		}
+		cutoff := time.Now().Add(-p.UnusedFor)
+		for _, e := range entries {
+			if e.LastUsed.Before(cutoff) {
+				p.Log.WithFields(logrus.Fields{"digest": e.Digest, "lastUsed": e.LastUsed.Format(time.RFC3339)}).Info("removing unused image cache entry")
+				if err := c.remove(e); err != nil {
+					return nil, err
+				}
+				res.RemovedImages = append(res.RemovedImages, e.Digest)
+			}
+		}
+	}
+	if p.MaxSize > 0 {
+		evicted, err := c.evict(p.Log, sets.NewString())
+		if err != nil {
+			return nil, err
+		}
+		res.RemovedImages = append(res.RemovedImages, evicted...)
+	}
+	return res, nil
+}
+
+// imageCache is a content-addressed cache of unpacked images, keyed by
+// manifest digest, that can be shared by concurrent dcm invocations. Access
+// is serialized with an advisory lock on a file in the cache directory, and
+// the least recently used entries are evicted when the cache grows beyond
+// its maximum size.
+type imageCache struct {
+	dir     string
+	maxSize int64
+}
+
+type imageCacheEntry struct {
+	Digest   string            `json:"digest"`
+	Refs     []string          `json:"refs"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	Size     int64             `json:"size"`
+	LastUsed time.Time         `json:"lastUsed"`
+}
+
+func openImageCache(dir string, maxSize int64) (*imageCache, error) {
+	if dir == "" {
+		return nil, errors.New("cache directory must be set")
+	}
+	for _, d := range []string{cacheEntriesDir, cacheStagingDir} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0777); err != nil {
+			return nil, fmt.Errorf("create image cache directory: %w", err)
+		}
+	}
+	return &imageCache{dir: dir, maxSize: maxSize}, nil
+}
+
+// openExistingImageCache opens the image cache in dir without creating it.
+// It returns nil if dir holds no image cache, which is then empty.
+func openExistingImageCache(dir string, maxSize int64) (*imageCache, error) {
+	if dir == "" {
+		return nil, errors.New("cache directory must be set")
+	}
+	if _, err := os.Stat(filepath.Join(dir, cacheEntriesDir)); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("open image cache: %w", err)
+	}
+	return &imageCache{dir: dir, maxSize: maxSize}, nil
+}
+
+func (c *imageCache) lock(exclusive bool) (func(), error) {
+	unlock, err := lockFile(filepath.Join(c.dir, cacheLockFile), exclusive, lockWaitForever, nil)
+	if err != nil {
+		return nil, fmt.Errorf("lock image cache %q: %w", c.dir, err)
+	}
+	return unlock, nil
+}
+
+func (c *imageCache) entryDir(dgst string) string {
+	return filepath.Join(c.dir, cacheEntriesDir, strings.Replace(dgst, ":", "-", 1))
+}
+
+func (c *imageCache) entries() ([]imageCacheEntry, error) {
+	dirs, err := os.ReadDir(filepath.Join(c.dir, cacheEntriesDir))
+	if err != nil {
+		return nil, err
+	}
+	var entries []imageCacheEntry
+	for _, d := range dirs {
+		e, err := readCacheEntry(filepath.Join(c.dir, cacheEntriesDir, d.Name()))
+		if err != nil {
+			// Skip entries that are incomplete or corrupt. They are
+			// overwritten the next time the image is pulled.
+			continue
+		}
+		entries = append(entries, *e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+	return entries, nil
+}
+
+func readCacheEntry(dir string) (*imageCacheEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dir, cacheEntryFile))
+	if err != nil {
+		return nil, err
+	}
+	var e imageCacheEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func writeCacheEntry(dir string, e imageCacheEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, cacheEntryFile), data, 0666)
+}
+
+// touch records a use of the entry for dgst by ref. It must be called with
+// the exclusive lock held.
+func (c *imageCache) touch(dgst, ref string) error {
+	dir := c.entryDir(dgst)
+	e, err := readCacheEntry(dir)
+	if err != nil {
+		return err
+	}
+	e.Refs = sets.NewString(append(e.Refs, ref)...).List()
+	e.LastUsed = time.Now()
+	return writeCacheEntry(dir, *e)
+}
+
+// commit moves the staged entry into the cache. It must be called with the
+// exclusive lock held.
+func (c *imageCache) commit(stagingDir string, e imageCacheEntry) error {
+	size, err := dirSize(filepath.Join(stagingDir, cacheContentDir))
+	if err != nil {
+		return err
+	}
+	e.Size = size
+	e.LastUsed = time.Now()
+	if err := writeCacheEntry(stagingDir, e); err != nil {
+		return err
+	}
+	dir := c.entryDir(e.Digest)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(stagingDir, dir)
+}
+
+func (c *imageCache) remove(e imageCacheEntry) error {
+	return os.RemoveAll(c.entryDir(e.Digest))
+}
+
+// evict removes the least recently used entries until the cache fits in its
+// maximum size. Entries whose digests are in keep are never evicted. It must
+// be called with the exclusive lock held.
+func (c *imageCache) evict(log *logrus.Logger, keep sets.String) ([]string, error) {
+	if c.maxSize <= 0 {
+		return nil, nil
+	}
+	entries, err := c.entries()
+	if err != nil {
+		return nil, err
+	}
+	var total int64
+	for _, e := range entries {
+		total += e.Size
+	}
+	var evicted []string
+	for i := len(entries) - 1; i >= 0 && total > c.maxSize; i-- {
+		e := entries[i]
+		if keep.Has(e.Digest) {
+			continue
+		}
+		log.WithFields(logrus.Fields{"digest": e.Digest, "refs": strings.Join(e.Refs, ",")}).Info("evicting image cache entry")
+		if err := c.remove(e); err != nil {
+			return nil, err
+		}
+		evicted = append(evicted, e.Digest)
+		total -= e.Size
+	}
+	return evicted, nil
+}
+
+// cachingRegistry is an image.Registry that serves unpacked images from an
+// imageCache, and only pulls images through the underlying registry when
+// their digest is not yet cached.
+type cachingRegistry struct {
+	image.Registry
+
+	cache    *imageCache
+	resolver remotes.Resolver
+	log      *logrus.Logger
+
+	// digests maps the references pulled in this run to their digests.
+	digests map[string]string
+}
+
+func newCachingRegistry(reg image.Registry, cache *imageCache, resolver remotes.Resolver, log *logrus.Logger) *cachingRegistry {
+	return &cachingRegistry{
+		Registry: reg,
+		cache:    cache,
+		resolver: resolver,
+		log:      log,
+		digests:  map[string]string{},
+	}
+}
+
+func (r *cachingRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	_, desc, err := r.resolver.Resolve(ctx, ref.String())
+	if err != nil {
+		return fmt.Errorf("error resolving name %s: %w", ref, err)
+	}
+	dgst := desc.Digest.String()
+	r.digests[ref.String()] = dgst
+
+	unlock, err := r.cache.lock(true)
+	if err != nil {
+		return err
+	}
+	err = r.cache.touch(dgst, ref.String())
+	unlock()
+	if err == nil {
+		r.log.WithFields(logrus.Fields{"image": ref, "digest": dgst}).Debug("using cached image")
+		return nil
+	}
+
+	if err := r.Registry.Pull(ctx, ref); err != nil {
+		return err
+	}
+	stagingDir, err := os.MkdirTemp(filepath.Join(r.cache.dir, cacheStagingDir), "")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stagingDir)
+	if err := r.Registry.Unpack(ctx, ref, filepath.Join(stagingDir, cacheContentDir)); err != nil {
+		return err
+	}
+	labels, err := r.Registry.Labels(ctx, ref)
+	if err != nil {
+		return err
+	}
+
+	unlock, err = r.cache.lock(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := r.cache.commit(stagingDir, imageCacheEntry{Digest: dgst, Refs: []string{ref.String()}, Labels: labels}); err != nil {
+		return fmt.Errorf("add %q to image cache: %w", ref, err)
+	}
+	keep := sets.NewString()
+	for _, d := range r.digests {
+		keep.Insert(d)
+	}
+	_, err = r.cache.evict(r.log, keep)
+	return err
+}
+
+func (r *cachingRegistry) Unpack(ctx context.Context, ref image.Reference, dir string) error {
+	dgst, ok := r.digests[ref.String()]
+	if !ok {
+		return fmt.Errorf("image %q has not been pulled", ref)
+	}
+	unlock, err := r.cache.lock(false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	content := filepath.Join(r.cache.entryDir(dgst), cacheContentDir)
+	if _, err := os.Stat(content); errors.Is(err, os.ErrNotExist) {
+		// The entry was evicted by a concurrent invocation since it was
+		// pulled, so bypass the cache.
+		r.log.WithFields(logrus.Fields{"image": ref, "digest": dgst}).Debug("image was evicted from the cache")
+		if err := r.Registry.Pull(ctx, ref); err != nil {
+			return err
+		}
+		return r.Registry.Unpack(ctx, ref, dir)
+	}
+	return copyDir(content, dir)
+}
+
+func (r *cachingRegistry) Labels(_ context.Context, ref image.Reference) (map[string]string, error) {
+	dgst, ok := r.digests[ref.String()]
+	if !ok {
+		return nil, fmt.Errorf("image %q has not been pulled", ref)
+	}
+	unlock, err := r.cache.lock(false)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	e, err := readCacheEntry(r.cache.entryDir(dgst))
+	if err != nil {
+		return nil, err
+	}
+	return e.Labels, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+func copyDir(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		default:
+			return copyFile(path, target, info.Mode().Perm())
+		}
+	})
+}
+
+func copyFile(src, dst string, perm fs.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
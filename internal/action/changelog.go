@@ -0,0 +1,262 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/operator-framework/operator-registry/alpha/model"
+	"github.com/operator-framework/operator-registry/pkg/registry"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+type Changelog struct {
+	OldDir string
+	NewDir string
+	// JSON writes the changes as JSON instead of Markdown.
+	JSON bool
+
+	Writer io.Writer
+}
+
+func (c Changelog) Run(_ context.Context) error {
+	oldModel, err := loadModel(c.OldDir)
+	if err != nil {
+		return fmt.Errorf("load old catalog: %w", err)
+	}
+	newModel, err := loadModel(c.NewDir)
+	if err != nil {
+		return fmt.Errorf("load new catalog: %w", err)
+	}
+	changes := diffModels(oldModel, newModel)
+	if c.JSON {
+		if changes == nil {
+			changes = []packageChanges{}
+		}
+		enc := json.NewEncoder(c.Writer)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changes)
+	}
+	return writeChangelog(c.Writer, changes)
+}
+
+// packageChanges describes the semantic differences of a single package
+// between two revisions of a catalog.
+type packageChanges struct {
+	Name string `json:"name"`
+
+	Added   bool `json:"added,omitempty"`
+	Removed bool `json:"removed,omitempty"`
+
+	OldDefaultChannel string `json:"oldDefaultChannel,omitempty"`
+	NewDefaultChannel string `json:"newDefaultChannel,omitempty"`
+
+	Channels []channelChanges `json:"channels,omitempty"`
+}
+
+func (p packageChanges) empty() bool {
+	return !p.Added && !p.Removed && p.OldDefaultChannel == p.NewDefaultChannel && len(p.Channels) == 0
+}
+
+// channelChanges describes the semantic differences of a single channel
+// between two revisions of a catalog.
+type channelChanges struct {
+	Name string `json:"name"`
+
+	Added   bool `json:"added,omitempty"`
+	Removed bool `json:"removed,omitempty"`
+
+	NewVersions        []versionEntry `json:"newVersions,omitempty"`
+	DeprecatedVersions []versionEntry `json:"deprecatedVersions,omitempty"`
+	RemovedVersions    []versionEntry `json:"removedVersions,omitempty"`
+}
+
+func (c channelChanges) empty() bool {
+	return !c.Added && !c.Removed && len(c.NewVersions) == 0 && len(c.DeprecatedVersions) == 0 && len(c.RemovedVersions) == 0
+}
+
+type versionEntry struct {
+	Bundle  string `json:"bundle"`
+	Version string `json:"version"`
+}
+
+func diffModels(oldModel, newModel model.Model) []packageChanges {
+	names := sets.NewString()
+	for name := range oldModel {
+		names.Insert(name)
+	}
+	for name := range newModel {
+		names.Insert(name)
+	}
+
+	var changes []packageChanges
+	for _, name := range names.List() {
+		pc := diffPackage(name, oldModel[name], newModel[name])
+		if !pc.empty() {
+			changes = append(changes, pc)
+		}
+	}
+	return changes
+}
+
+func diffPackage(name string, oldPkg, newPkg *model.Package) packageChanges {
+	pc := packageChanges{
+		Name:              name,
+		Added:             oldPkg == nil,
+		Removed:           newPkg == nil,
+		OldDefaultChannel: defaultChannelName(oldPkg),
+		NewDefaultChannel: defaultChannelName(newPkg),
+	}
+
+	channelNames := sets.NewString()
+	oldChannels := map[string]*model.Channel{}
+	newChannels := map[string]*model.Channel{}
+	if oldPkg != nil {
+		oldChannels = oldPkg.Channels
+	}
+	if newPkg != nil {
+		newChannels = newPkg.Channels
+	}
+	for chName := range oldChannels {
+		channelNames.Insert(chName)
+	}
+	for chName := range newChannels {
+		channelNames.Insert(chName)
+	}
+	for _, chName := range channelNames.List() {
+		cc := diffChannel(chName, oldChannels[chName], newChannels[chName])
+		if !cc.empty() {
+			pc.Channels = append(pc.Channels, cc)
+		}
+	}
+	return pc
+}
+
+func diffChannel(name string, oldCh, newCh *model.Channel) channelChanges {
+	cc := channelChanges{
+		Name:    name,
+		Added:   oldCh == nil,
+		Removed: newCh == nil,
+	}
+	oldBundles := map[string]*model.Bundle{}
+	newBundles := map[string]*model.Bundle{}
+	if oldCh != nil {
+		oldBundles = oldCh.Bundles
+	}
+	if newCh != nil {
+		newBundles = newCh.Bundles
+	}
+
+	for bName, b := range newBundles {
+		ob, ok := oldBundles[bName]
+		switch {
+		case !ok:
+			cc.NewVersions = append(cc.NewVersions, newVersionEntry(b))
+		case !isDeprecated(ob) && isDeprecated(b):
+			cc.DeprecatedVersions = append(cc.DeprecatedVersions, newVersionEntry(b))
+		}
+	}
+	for bName, b := range oldBundles {
+		if _, ok := newBundles[bName]; !ok {
+			cc.RemovedVersions = append(cc.RemovedVersions, newVersionEntry(b))
+		}
+	}
+	sortVersionEntries(cc.NewVersions, newBundles)
+	sortVersionEntries(cc.DeprecatedVersions, newBundles)
+	sortVersionEntries(cc.RemovedVersions, oldBundles)
+	return cc
+}
+
+func newVersionEntry(b *model.Bundle) versionEntry {
+	return versionEntry{
+		Bundle:  b.Name,
+		Version: b.Version.String(),
+	}
+}
+
+// sortVersionEntries sorts entries from newest to oldest version, falling
+// back to the bundle name for bundles with equal versions.
+func sortVersionEntries(entries []versionEntry, bundles map[string]*model.Bundle) {
+	sort.Slice(entries, func(i, j int) bool {
+		vi, vj := bundles[entries[i].Bundle].Version, bundles[entries[j].Bundle].Version
+		if c := vi.Compare(vj); c != 0 {
+			return c > 0
+		}
+		return entries[i].Bundle < entries[j].Bundle
+	})
+}
+
+func isDeprecated(b *model.Bundle) bool {
+	for _, p := range b.Properties {
+		if p.Type == registry.DeprecatedType {
+			return true
+		}
+	}
+	return false
+}
+
+func defaultChannelName(pkg *model.Package) string {
+	if pkg == nil || pkg.DefaultChannel == nil {
+		return ""
+	}
+	return pkg.DefaultChannel.Name
+}
+
+func writeChangelog(w io.Writer, changes []packageChanges) error {
+	ew := &errWriter{w: w}
+	ew.printf("# Changelog\n")
+	if len(changes) == 0 {
+		ew.printf("\nNo changes.\n")
+		return ew.err
+	}
+	for _, pc := range changes {
+		ew.printf("\n## %s\n", pc.Name)
+		switch {
+		case pc.Added:
+			ew.printf("\n- New package with default channel `%s`\n", pc.NewDefaultChannel)
+		case pc.Removed:
+			ew.printf("\n- Package removed\n")
+		case pc.OldDefaultChannel != pc.NewDefaultChannel:
+			ew.printf("\n- Default channel changed from `%s` to `%s`\n", pc.OldDefaultChannel, pc.NewDefaultChannel)
+		}
+		for _, cc := range pc.Channels {
+			ew.printf("\n### Channel `%s`\n\n", cc.Name)
+			if cc.Added && !pc.Added {
+				ew.printf("- New channel\n")
+			}
+			if cc.Removed && !pc.Removed {
+				ew.printf("- Channel removed\n")
+			}
+			writeVersionEntries(ew, "New versions", cc.NewVersions)
+			writeVersionEntries(ew, "Deprecated versions", cc.DeprecatedVersions)
+			writeVersionEntries(ew, "Removed versions (deprecated or truncated)", cc.RemovedVersions)
+		}
+	}
+	return ew.err
+}
+
+func writeVersionEntries(ew *errWriter, title string, entries []versionEntry) {
+	if len(entries) == 0 {
+		return
+	}
+	ew.printf("- %s:\n", title)
+	for _, e := range entries {
+		ew.printf("  - %s (`%s`)\n", e.Version, e.Bundle)
+	}
+}
+
+// errWriter wraps an io.Writer and remembers the first write error so that
+// callers can issue a sequence of writes and check for failure once.
+type errWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ew *errWriter) printf(format string, args ...interface{}) {
+	if ew.err != nil {
+		return
+	}
+	_, ew.err = fmt.Fprintf(ew.w, format, args...)
+}
@@ -0,0 +1,139 @@
+package action
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/registry"
+)
+
+func TestDiffModels(t *testing.T) {
+	type spec struct {
+		name string
+		// old and new change the test catalog into the old and new
+		// revisions, when not nil.
+		old, new func(fbc *declcfg.DeclarativeConfig)
+		expect   []packageChanges
+	}
+	specs := []spec{
+		{
+			name: "NoChanges",
+		},
+		{
+			name: "NewVersion",
+			new: func(fbc *declcfg.DeclarativeConfig) {
+				ch := findChannel(fbc.Channels, "foo", "fast")
+				ch.Entries = append(ch.Entries, declcfg.ChannelEntry{Name: "foo.v0.4.0", Replaces: "foo.v0.3.0"})
+				fbc.Bundles = append(fbc.Bundles, declcfg.Bundle{
+					Schema: "olm.bundle", Package: "foo", Name: "foo.v0.4.0", Image: "quay.io/example/foo-bundle:v0.4.0",
+					Properties: []property.Property{property.MustBuildPackage("foo", "0.4.0")},
+				})
+			},
+			expect: []packageChanges{{
+				Name:              "foo",
+				OldDefaultChannel: "stable",
+				NewDefaultChannel: "stable",
+				Channels: []channelChanges{{
+					Name:        "fast",
+					NewVersions: []versionEntry{{Bundle: "foo.v0.4.0", Version: "0.4.0"}},
+				}},
+			}},
+		},
+		{
+			name: "DeprecatedVersion",
+			new: func(fbc *declcfg.DeclarativeConfig) {
+				b, _ := findBundle(fbc.Bundles, "foo.v0.1.0")
+				b.Properties = append(b.Properties, property.Property{Type: registry.DeprecatedType, Value: json.RawMessage(`{}`)})
+			},
+			expect: []packageChanges{{
+				Name:              "foo",
+				OldDefaultChannel: "stable",
+				NewDefaultChannel: "stable",
+				Channels: []channelChanges{
+					{Name: "fast", DeprecatedVersions: []versionEntry{{Bundle: "foo.v0.1.0", Version: "0.1.0"}}},
+					{Name: "stable", DeprecatedVersions: []versionEntry{{Bundle: "foo.v0.1.0", Version: "0.1.0"}}},
+				},
+			}},
+		},
+		{
+			name: "RemovedChannel",
+			new: func(fbc *declcfg.DeclarativeConfig) {
+				fbc.Channels = fbc.Channels[:1]
+				fbc.Bundles = fbc.Bundles[:2]
+			},
+			expect: []packageChanges{{
+				Name:              "foo",
+				OldDefaultChannel: "stable",
+				NewDefaultChannel: "stable",
+				Channels: []channelChanges{{
+					Name:    "fast",
+					Removed: true,
+					RemovedVersions: []versionEntry{
+						{Bundle: "foo.v0.3.0", Version: "0.3.0"},
+						{Bundle: "foo.v0.2.0", Version: "0.2.0"},
+						{Bundle: "foo.v0.1.0", Version: "0.1.0"},
+					},
+				}},
+			}},
+		},
+		{
+			name: "DefaultChannel",
+			new: func(fbc *declcfg.DeclarativeConfig) {
+				fbc.Packages[0].DefaultChannel = "fast"
+			},
+			expect: []packageChanges{{
+				Name:              "foo",
+				OldDefaultChannel: "stable",
+				NewDefaultChannel: "fast",
+			}},
+		},
+		{
+			name: "AddedPackage",
+			old: func(fbc *declcfg.DeclarativeConfig) {
+				*fbc = declcfg.DeclarativeConfig{}
+			},
+			new: func(fbc *declcfg.DeclarativeConfig) {
+				fbc.Channels = fbc.Channels[:1]
+				fbc.Bundles = fbc.Bundles[:2]
+			},
+			expect: []packageChanges{{
+				Name:              "foo",
+				Added:             true,
+				NewDefaultChannel: "stable",
+				Channels: []channelChanges{{
+					Name:  "stable",
+					Added: true,
+					NewVersions: []versionEntry{
+						{Bundle: "foo.v0.2.0", Version: "0.2.0"},
+						{Bundle: "foo.v0.1.0", Version: "0.1.0"},
+					},
+				}},
+			}},
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			oldFBC, newFBC := testCatalog(), testCatalog()
+			if s.old != nil {
+				s.old(oldFBC)
+			}
+			if s.new != nil {
+				s.new(newFBC)
+			}
+			oldModel, err := declcfg.ConvertToModel(*oldFBC)
+			if err != nil {
+				t.Fatalf("convert old catalog: %v", err)
+			}
+			newModel, err := declcfg.ConvertToModel(*newFBC)
+			if err != nil {
+				t.Fatalf("convert new catalog: %v", err)
+			}
+			if changes := diffModels(oldModel, newModel); !reflect.DeepEqual(changes, s.expect) {
+				t.Errorf("expected changes:\n%+v\ngot:\n%+v", s.expect, changes)
+			}
+		})
+	}
+}
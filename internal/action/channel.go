@@ -0,0 +1,212 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// ChannelPromote adds an existing bundle, along with its replaces chain, to
+// another channel of the bundle's package.
+type ChannelPromote struct {
+	FromDir string
+	// Bundle is the name or image of the bundle to promote.
+	Bundle string
+	// FromChannel is the channel whose replaces chain is copied. It may be
+	// left empty when the bundle is a member of exactly one channel.
+	FromChannel string
+	ToChannel   string
+
+	LockTimeout time.Duration
+	Log         *logrus.Logger
+}
+
+func (p ChannelPromote) Run(_ context.Context) (*Result, error) {
+	return mutateFBC(p.FromDir, p.LockTimeout, p.Log, p.apply)
+}
+
+func (p ChannelPromote) apply(fbc *declcfg.DeclarativeConfig) error {
+	b, err := findBundle(fbc.Bundles, p.Bundle)
+	if err != nil {
+		return err
+	}
+
+	var from *declcfg.Channel
+	for i, ch := range fbc.Channels {
+		if ch.Package != b.Package || !channelHasEntry(ch, b.Name) {
+			continue
+		}
+		if p.FromChannel != "" && ch.Name != p.FromChannel {
+			continue
+		}
+		if from != nil {
+			return fmt.Errorf("bundle %q is present in multiple channels, a source channel must be specified", b.Name)
+		}
+		from = &fbc.Channels[i]
+	}
+	if from == nil {
+		if p.FromChannel != "" && findChannel(fbc.Channels, b.Package, p.FromChannel) == nil {
+			return classify(ErrInvalidInput, fmt.Errorf("channel %q not found in package %q", p.FromChannel, b.Package))
+		}
+		if p.FromChannel != "" {
+			return classify(ErrBundleNotFound, fmt.Errorf("bundle %q not found in channel %q of package %q", b.Name, p.FromChannel, b.Package))
+		}
+		return classify(ErrBundleNotFound, fmt.Errorf("bundle %q not found in any channel of package %q", b.Name, b.Package))
+	}
+	if from.Name == p.ToChannel {
+		return classify(ErrBundleExists, fmt.Errorf("bundle %q is already present in channel %q", b.Name, p.ToChannel))
+	}
+
+	fromEntries := map[string]declcfg.ChannelEntry{}
+	for _, e := range from.Entries {
+		fromEntries[e.Name] = e
+	}
+
+	to := findChannel(fbc.Channels, b.Package, p.ToChannel)
+	if to == nil {
+		p.Log.WithFields(logrus.Fields{"package": b.Package, "channel": p.ToChannel}).Info("creating channel")
+		fbc.Channels = append(fbc.Channels, declcfg.Channel{
+			Schema:  "olm.channel",
+			Name:    p.ToChannel,
+			Package: b.Package,
+		})
+		to = &fbc.Channels[len(fbc.Channels)-1]
+	}
+
+	// Walk the replaces chain in the source channel, starting at the promoted
+	// bundle, and copy every entry that is not yet present in the target
+	// channel. The walk stops where the chain joins the target channel.
+	for cur, ok := fromEntries[b.Name]; ok; cur, ok = fromEntries[cur.Replaces] {
+		if channelHasEntry(*to, cur.Name) {
+			break
+		}
+		p.Log.WithFields(logrus.Fields{"package": b.Package, "channel": p.ToChannel, "bundle": cur.Name}).Info("promoting bundle")
+		to.Entries = append(to.Entries, cur)
+	}
+
+	// Only channel heads keep their bundle objects, which OLM needs to
+	// install them: a bundle that was not a head cannot become one here.
+	if entryHeads(*to).Has(b.Name) && !hasBundleObjects(*b) {
+		return classify(ErrInvalidInput, fmt.Errorf("bundle %q would become the head of channel %q, but it has no bundle objects, which only channel heads keep: promote a channel head instead", b.Name, p.ToChannel))
+	}
+	return nil
+}
+
+// ChannelSetDefault sets the default channel of a package.
+type ChannelSetDefault struct {
+	FromDir string
+	Package string
+	Channel string
+
+	LockTimeout time.Duration
+	Log         *logrus.Logger
+}
+
+func (s ChannelSetDefault) Run(_ context.Context) (*Result, error) {
+	return mutateFBC(s.FromDir, s.LockTimeout, s.Log, s.apply)
+}
+
+func (s ChannelSetDefault) apply(fbc *declcfg.DeclarativeConfig) error {
+	if findChannel(fbc.Channels, s.Package, s.Channel) == nil {
+		return classify(ErrInvalidInput, fmt.Errorf("channel %q not found in package %q", s.Channel, s.Package))
+	}
+	for i, p := range fbc.Packages {
+		if p.Name == s.Package {
+			s.Log.WithFields(logrus.Fields{"package": s.Package, "channel": s.Channel}).Info("setting default channel")
+			fbc.Packages[i].DefaultChannel = s.Channel
+			return nil
+		}
+	}
+	return classify(ErrInvalidInput, fmt.Errorf("package %q not found", s.Package))
+}
+
+// ChannelRename renames a channel of a package, updating the package's
+// default channel if necessary.
+type ChannelRename struct {
+	FromDir string
+	Package string
+	Channel string
+	NewName string
+
+	LockTimeout time.Duration
+	Log         *logrus.Logger
+}
+
+func (r ChannelRename) Run(_ context.Context) (*Result, error) {
+	return mutateFBC(r.FromDir, r.LockTimeout, r.Log, r.apply)
+}
+
+func (r ChannelRename) apply(fbc *declcfg.DeclarativeConfig) error {
+	ch := findChannel(fbc.Channels, r.Package, r.Channel)
+	if ch == nil {
+		return classify(ErrInvalidInput, fmt.Errorf("channel %q not found in package %q", r.Channel, r.Package))
+	}
+	if findChannel(fbc.Channels, r.Package, r.NewName) != nil {
+		return fmt.Errorf("channel %q already exists in package %q", r.NewName, r.Package)
+	}
+	r.Log.WithFields(logrus.Fields{"package": r.Package, "channel": r.Channel, "newName": r.NewName}).Info("renaming channel")
+	ch.Name = r.NewName
+	for i, p := range fbc.Packages {
+		if p.Name == r.Package && p.DefaultChannel == r.Channel {
+			fbc.Packages[i].DefaultChannel = r.NewName
+		}
+	}
+	return nil
+}
+
+// ChannelRemove deletes a channel from a package. Bundles that are no longer
+// members of any channel are removed from the catalog.
+type ChannelRemove struct {
+	FromDir string
+	Package string
+	Channel string
+
+	LockTimeout time.Duration
+	Log         *logrus.Logger
+}
+
+func (r ChannelRemove) Run(_ context.Context) (*Result, error) {
+	return mutateFBC(r.FromDir, r.LockTimeout, r.Log, r.apply)
+}
+
+func (r ChannelRemove) apply(fbc *declcfg.DeclarativeConfig) error {
+	if findChannel(fbc.Channels, r.Package, r.Channel) == nil {
+		return classify(ErrInvalidInput, fmt.Errorf("channel %q not found in package %q", r.Channel, r.Package))
+	}
+	for _, p := range fbc.Packages {
+		if p.Name == r.Package && p.DefaultChannel == r.Channel {
+			return fmt.Errorf("cannot remove channel %q: it is the default channel of package %q", r.Channel, r.Package)
+		}
+	}
+
+	r.Log.WithFields(logrus.Fields{"package": r.Package, "channel": r.Channel}).Info("removing channel")
+	remaining := sets.NewString()
+	tmpChannels := fbc.Channels[:0]
+	for _, ch := range fbc.Channels {
+		if ch.Package == r.Package && ch.Name == r.Channel {
+			continue
+		}
+		if ch.Package == r.Package {
+			for _, e := range ch.Entries {
+				remaining.Insert(e.Name)
+			}
+		}
+		tmpChannels = append(tmpChannels, ch)
+	}
+	fbc.Channels = tmpChannels
+
+	tmpBundles := fbc.Bundles[:0]
+	for _, b := range fbc.Bundles {
+		if b.Package == r.Package && !remaining.Has(b.Name) {
+			r.Log.WithFields(logrus.Fields{"package": b.Package, "bundle": b.Name}).Info("removing bundle: it is no longer a member of any channel")
+			continue
+		}
+		tmpBundles = append(tmpBundles, b)
+	}
+	fbc.Bundles = tmpBundles
+	return nil
+}
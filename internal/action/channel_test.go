@@ -0,0 +1,212 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/sirupsen/logrus"
+)
+
+func TestChannelPromote(t *testing.T) {
+	type spec struct {
+		name        string
+		bundle      string
+		fromChannel string
+		toChannel   string
+		// setup changes the test catalog before the promotion, when not nil.
+		setup func(fbc *declcfg.DeclarativeConfig)
+		// expectErr is set for errors of no class, and expectClass for
+		// the others.
+		expectErr   bool
+		expectClass error
+		// expectEntries are the expected entries of the target channel.
+		expectEntries []declcfg.ChannelEntry
+	}
+	specs := []spec{
+		{
+			name:      "NewChannel",
+			bundle:    "foo.v0.3.0",
+			toChannel: "candidate",
+			expectEntries: []declcfg.ChannelEntry{
+				{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0"},
+				{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+				{Name: "foo.v0.1.0"},
+			},
+		},
+		{
+			name:      "JoinsExistingChain",
+			bundle:    "quay.io/example/foo-bundle:v0.3.0",
+			toChannel: "stable",
+			expectEntries: []declcfg.ChannelEntry{
+				{Name: "foo.v0.1.0"},
+				{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+				{Name: "foo.v0.3.0", Replaces: "foo.v0.2.0"},
+			},
+		},
+		{
+			name:        "FromChannel",
+			bundle:      "foo.v0.2.0",
+			fromChannel: "stable",
+			toChannel:   "candidate",
+			expectEntries: []declcfg.ChannelEntry{
+				{Name: "foo.v0.2.0", Replaces: "foo.v0.1.0"},
+				{Name: "foo.v0.1.0"},
+			},
+		},
+		{
+			name:      "AmbiguousSourceChannel",
+			bundle:    "foo.v0.2.0",
+			toChannel: "candidate",
+			expectErr: true,
+		},
+		{
+			name:        "UnknownSourceChannel",
+			bundle:      "foo.v0.2.0",
+			fromChannel: "beta",
+			toChannel:   "candidate",
+			expectClass: ErrInvalidInput,
+		},
+		{
+			name:        "NotInSourceChannel",
+			bundle:      "foo.v0.3.0",
+			fromChannel: "stable",
+			toChannel:   "candidate",
+			expectClass: ErrBundleNotFound,
+		},
+		{
+			name:        "UnknownBundle",
+			bundle:      "foo.v9.9.9",
+			toChannel:   "candidate",
+			expectClass: ErrBundleNotFound,
+		},
+		{
+			name:        "AlreadyInChannel",
+			bundle:      "foo.v0.3.0",
+			fromChannel: "fast",
+			toChannel:   "fast",
+			expectClass: ErrBundleExists,
+		},
+		{
+			name:        "NewHeadWithoutObjects",
+			bundle:      "foo.v0.1.0",
+			fromChannel: "stable",
+			toChannel:   "candidate",
+			setup: func(fbc *declcfg.DeclarativeConfig) {
+				b, _ := findBundle(fbc.Bundles, "foo.v0.1.0")
+				b.Properties = withoutBundleObjects(b.Properties)
+			},
+			expectClass: ErrInvalidInput,
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			fbc := testCatalog()
+			if s.setup != nil {
+				s.setup(fbc)
+			}
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+			p := ChannelPromote{Bundle: s.bundle, FromChannel: s.fromChannel, ToChannel: s.toChannel, Log: log}
+
+			err := p.apply(fbc)
+			if s.expectClass != nil {
+				if !errors.Is(err, s.expectClass) {
+					t.Fatalf("expected error %v, got %v", s.expectClass, err)
+				}
+				return
+			}
+			if s.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := validateFBC(*fbc); err != nil {
+				t.Fatalf("result is invalid: %v", err)
+			}
+			ch := findChannel(fbc.Channels, "foo", s.toChannel)
+			if ch == nil {
+				t.Fatalf("channel %q not found", s.toChannel)
+			}
+			if !reflect.DeepEqual(ch.Entries, s.expectEntries) {
+				t.Errorf("entries of channel %q:\nexpected %+v\ngot      %+v", s.toChannel, s.expectEntries, ch.Entries)
+			}
+		})
+	}
+}
+
+func TestChannelRemove(t *testing.T) {
+	type spec struct {
+		name           string
+		channel        string
+		expectErr      bool
+		expectClass    error
+		expectChannels []string
+		expectBundles  []string
+	}
+	specs := []spec{
+		{
+			name:           "RemovesBundlesOnlyInChannel",
+			channel:        "fast",
+			expectChannels: []string{"stable"},
+			expectBundles:  []string{"foo.v0.1.0", "foo.v0.2.0"},
+		},
+		{
+			name:      "DefaultChannel",
+			channel:   "stable",
+			expectErr: true,
+		},
+		{
+			name:        "UnknownChannel",
+			channel:     "beta",
+			expectClass: ErrInvalidInput,
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			fbc := testCatalog()
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+			r := ChannelRemove{Package: "foo", Channel: s.channel, Log: log}
+
+			err := r.apply(fbc)
+			if s.expectClass != nil {
+				if !errors.Is(err, s.expectClass) {
+					t.Fatalf("expected error %v, got %v", s.expectClass, err)
+				}
+				return
+			}
+			if s.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := validateFBC(*fbc); err != nil {
+				t.Fatalf("result is invalid: %v", err)
+			}
+			var channels, bundles []string
+			for _, ch := range fbc.Channels {
+				channels = append(channels, ch.Name)
+			}
+			for _, b := range fbc.Bundles {
+				bundles = append(bundles, b.Name)
+			}
+			if !reflect.DeepEqual(channels, s.expectChannels) {
+				t.Errorf("expected channels %v, got %v", s.expectChannels, channels)
+			}
+			if !reflect.DeepEqual(bundles, s.expectBundles) {
+				t.Errorf("expected bundles %v, got %v", s.expectBundles, bundles)
+			}
+		})
+	}
+}
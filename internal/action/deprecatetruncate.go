@@ -3,8 +3,8 @@ package action
 import (
 	"context"
 	"fmt"
-	"os"
 	"strings"
+	"time"
 
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
 	"github.com/sirupsen/logrus"
@@ -15,7 +15,8 @@ type DeprecateTruncate struct {
 	FromDir      string
 	BundleImages []string
 
-	Log *logrus.Logger
+	LockTimeout time.Duration
+	Log         *logrus.Logger
 }
 
 func (d DeprecateTruncate) getBundlesToDeprecate(bundles []declcfg.Bundle) ([]declcfg.Bundle, error) {
@@ -30,12 +31,16 @@ func (d DeprecateTruncate) getBundlesToDeprecate(bundles []declcfg.Bundle) ([]de
 	}
 	notFound := depImages.Difference(foundImages)
 	if notFound.Len() > 0 {
-		return nil, fmt.Errorf("could not find bundles in the index: %q", strings.Join(notFound.List(), ","))
+		return nil, classify(ErrBundleNotFound, fmt.Errorf("could not find bundles in the index: %q", strings.Join(notFound.List(), ",")))
 	}
 	return found, nil
 }
 
-func (d DeprecateTruncate) Run(ctx context.Context) error {
+func (d DeprecateTruncate) Run(_ context.Context) (*Result, error) {
+	return mutateFBC(d.FromDir, d.LockTimeout, d.Log, d.apply)
+}
+
+func (d DeprecateTruncate) apply(fromCfg *declcfg.DeclarativeConfig) error {
 	// Deprecatetruncate for FBC is just removing the deprecated bundle and its tail.
 	// In FBC, there is no requirement that every bundle referenced by a replaces value is in
 	// the channel or package, so keeping a deprecated bundle around is unnecessary.
@@ -51,22 +56,13 @@ func (d DeprecateTruncate) Run(ctx context.Context) error {
 	//     - If a removed entry cannot be found in any channel, remove
 	//       the olm.bundle blob for that entry from the catalog
 
-	d.Log.Infof("Loading declarative configs")
-	fromCfg, err := declcfg.LoadFS(os.DirFS(d.FromDir))
-	if err != nil {
-		return fmt.Errorf("load declarative configs: %v", err)
-	}
-
-	if _, err := declcfg.ConvertToModel(*fromCfg); err != nil {
-		return fmt.Errorf("input catalog is invalid: %v", err)
-	}
-
 	depBundles, err := d.getBundlesToDeprecate(fromCfg.Bundles)
 	if err != nil {
 		return err
 	}
 
 	for _, depBundle := range depBundles {
+		d.Log.WithFields(logrus.Fields{"package": depBundle.Package, "bundle": depBundle.Name, "image": depBundle.Image}).Info("deprecating bundle")
 		removedFromChannel := sets.NewString()
 		for i, ch := range fromCfg.Channels {
 			// We only care about the bundle's package.
@@ -141,10 +137,5 @@ func (d DeprecateTruncate) Run(ctx context.Context) error {
 		}
 		fromCfg.Bundles = tmpBundles
 	}
-	if _, err := declcfg.ConvertToModel(*fromCfg); err != nil {
-		return fmt.Errorf("updated file-based catalog is invalid: %v", err)
-	}
-
-	d.Log.Infof("Writing updated file-based catalog")
-	return writeToFS(*fromCfg, d.FromDir, declcfg.WriteYAML)
+	return nil
 }
@@ -0,0 +1,61 @@
+package action
+
+import "errors"
+
+// Classes of errors returned by actions. Errors of a class match it with
+// errors.Is, and keep their underlying cause.
+var (
+	// ErrBundleExists is returned when a bundle is already present where it
+	// is added, and cannot be overwritten.
+	ErrBundleExists = errors.New("bundle already present")
+	// ErrBundleNotFound is returned when a bundle to operate on is not in the
+	// catalog.
+	ErrBundleNotFound = errors.New("bundle not found")
+	// ErrInvalidInput is returned when the catalog to operate on cannot be
+	// loaded or is invalid.
+	ErrInvalidInput = errors.New("invalid input catalog")
+	// ErrInvalidResult is returned when an operation would produce an
+	// invalid catalog. Nothing is written in that case.
+	ErrInvalidResult = errors.New("invalid result catalog")
+	// ErrPull is returned when an image cannot be pulled or resolved. Such
+	// failures are often transient, and may be retried.
+	ErrPull = errors.New("pull failed")
+	// ErrOutputNotEmpty is returned when the output directory or file of an
+	// action already has contents.
+	ErrOutputNotEmpty = errors.New("output not empty")
+	// ErrLocked is returned when the lock of a declarative config directory
+	// cannot be acquired in time.
+	ErrLocked = errors.New("catalog locked")
+	// ErrCatalogChanged is returned when a declarative config directory is
+	// modified by another process while an action updates it.
+	ErrCatalogChanged = errors.New("catalog changed")
+	// ErrLintFailed is returned when a catalog violates lint rules of
+	// severity error.
+	ErrLintFailed = errors.New("lint failed")
+	// ErrInvalidBundle is returned when the validators find problems in a
+	// bundle that is added. Nothing is written in that case.
+	ErrInvalidBundle = errors.New("invalid bundle")
+)
+
+// classifiedError is an error of a class, such as ErrPull.
+type classifiedError struct {
+	class error
+	err   error
+}
+
+// classify marks err as an error of class.
+func classify(class, err error) error {
+	return &classifiedError{class: class, err: err}
+}
+
+func (e *classifiedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *classifiedError) Unwrap() error {
+	return e.err
+}
+
+func (e *classifiedError) Is(target error) bool {
+	return target == e.class
+}
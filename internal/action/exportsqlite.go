@@ -0,0 +1,230 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/operator-framework/operator-registry/alpha/model"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/operator-framework/operator-registry/pkg/registry"
+	"github.com/operator-framework/operator-registry/pkg/sqlite"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// ExportSqlite writes a declarative config directory as a sqlite index
+// database, the reverse of Migrate.
+//
+// Bundles are loaded from their olm.bundle.object properties. Bundles without
+// objects, which is the case for every bundle that is not a channel head in
+// catalogs built by dcm, are pulled from their bundle image instead. Channel
+// graphs are taken from the channel entries rather than from the replaces
+// and skips of the CSVs.
+type ExportSqlite struct {
+	FromDir    string
+	OutputFile string
+
+	RegistryOptions RegistryOptions
+	Log             *logrus.Logger
+}
+
+func (e ExportSqlite) Run(ctx context.Context) (res *Result, err error) {
+	m, err := loadModel(e.FromDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(e.OutputFile); err == nil {
+		return nil, classify(ErrOutputNotEmpty, fmt.Errorf("output file %q already exists", e.OutputFile))
+	}
+
+	db, err := sqlite.Open(e.OutputFile)
+	if err != nil {
+		return nil, fmt.Errorf("open database %q: %w", e.OutputFile, err)
+	}
+	defer func() {
+		db.Close()
+		if err != nil {
+			os.Remove(e.OutputFile)
+		}
+	}()
+	loader, err := sqlite.NewSQLLiteLoader(db, sqlite.WithEnableAlpha(true))
+	if err != nil {
+		return nil, fmt.Errorf("create database loader: %w", err)
+	}
+	if err := loader.Migrate(ctx); err != nil {
+		return nil, fmt.Errorf("migrate database schema: %w", err)
+	}
+	// The sqlite loader can build channels from an explicit graph, but does
+	// not expose it in its interface.
+	graphLoader, ok := loader.(interface {
+		AddPackageChannelsFromGraph(*registry.Package) error
+	})
+	if !ok {
+		return nil, fmt.Errorf("database loader does not support loading channel graphs")
+	}
+
+	// The registry is only needed for bundles without objects, and is
+	// created on first use.
+	var reg image.Registry
+	defer func() {
+		if reg != nil {
+			destroyRegistry(reg, e.Log)
+		}
+	}()
+	getRegistry := func() (image.Registry, error) {
+		if reg == nil {
+			var err error
+			if reg, err = newRegistry(e.RegistryOptions, e.Log); err != nil {
+				return nil, fmt.Errorf("create temporary image registry: %w", err)
+			}
+		}
+		return reg, nil
+	}
+
+	res = &Result{}
+	var deprecated []string
+	for _, pkg := range sortedPackages(m) {
+		e.Log.WithField("package", pkg.Name).Info("exporting package")
+		added := map[string]struct{}{}
+		for _, ch := range pkg.Channels {
+			for _, b := range ch.Bundles {
+				if _, ok := added[b.Name]; ok {
+					continue
+				}
+				added[b.Name] = struct{}{}
+
+				rb, err := e.registryBundle(ctx, b, getRegistry)
+				if err != nil {
+					return nil, fmt.Errorf("load bundle %q: %w", b.Name, err)
+				}
+				if err := loader.AddOperatorBundle(rb); err != nil {
+					return nil, fmt.Errorf("add bundle %q: %w", b.Name, err)
+				}
+				res.AddedBundles = append(res.AddedBundles, pkg.Name+"/"+b.Name)
+				if isDeprecated(b) {
+					deprecated = append(deprecated, b.Image)
+				}
+			}
+		}
+		if err := graphLoader.AddPackageChannelsFromGraph(packageGraph(pkg)); err != nil {
+			return nil, fmt.Errorf("add channels of package %q: %w", pkg.Name, err)
+		}
+	}
+	for _, img := range deprecated {
+		if err := loader.DeprecateBundle(img); err != nil {
+			return nil, fmt.Errorf("deprecate bundle %q: %w", img, err)
+		}
+	}
+	e.Log.WithField("file", e.OutputFile).Info("wrote sqlite index database")
+	sort.Strings(res.AddedBundles)
+	res.FilesWritten = []string{e.OutputFile}
+	return res, nil
+}
+
+// registryBundle converts b to a registry bundle, pulling its bundle image if
+// the declarative config does not contain its objects.
+func (e ExportSqlite) registryBundle(ctx context.Context, b *model.Bundle, getRegistry func() (image.Registry, error)) (*registry.Bundle, error) {
+	var (
+		rb  *registry.Bundle
+		err error
+	)
+	if len(b.Objects) == 0 {
+		reg, err := getRegistry()
+		if err != nil {
+			return nil, err
+		}
+		e.Log.WithFields(logrus.Fields{"package": b.Package.Name, "bundle": b.Name, "image": b.Image}).Info("pulling bundle")
+		if rb, err = getRegistryBundle(ctx, reg, b.Image, nil); err != nil {
+			return nil, err
+		}
+	} else {
+		annotations := &registry.Annotations{
+			PackageName:        b.Package.Name,
+			DefaultChannelName: b.Package.DefaultChannel.Name,
+		}
+		rb = registry.NewBundle(b.Name, annotations)
+		for _, obj := range b.Objects {
+			u := &unstructured.Unstructured{}
+			if err := json.Unmarshal([]byte(obj), &u.Object); err != nil {
+				return nil, fmt.Errorf("parse bundle object: %w", err)
+			}
+			rb.Add(u)
+		}
+		if rb.Properties, err = otherProperties(b.Properties); err != nil {
+			return nil, err
+		}
+	}
+	rb.BundleImage = b.Image
+	return rb, nil
+}
+
+// otherProperties returns the properties that the sqlite loader does not
+// derive from the bundle objects themselves.
+func otherProperties(props []property.Property) ([]registry.Property, error) {
+	parsed, err := property.Parse(props)
+	if err != nil {
+		return nil, err
+	}
+	var out []registry.Property
+	for _, p := range parsed.Others {
+		// Deprecations are recorded separately, see DeprecateBundle.
+		if p.Type == registry.DeprecatedType {
+			continue
+		}
+		out = append(out, registry.Property{Type: p.Type, Value: p.Value})
+	}
+	return out, nil
+}
+
+// packageGraph returns the channel graphs of pkg. Only replaces edges are
+// followed between channel members; skips and replaced bundles that are not
+// channel members become synthetic entries.
+func packageGraph(pkg *model.Package) *registry.Package {
+	graph := &registry.Package{
+		Name:           pkg.Name,
+		DefaultChannel: pkg.DefaultChannel.Name,
+		Channels:       map[string]registry.Channel{},
+	}
+	for _, ch := range pkg.Channels {
+		keys := map[string]registry.BundleKey{}
+		for _, b := range ch.Bundles {
+			keys[b.Name] = registry.BundleKey{BundlePath: b.Image, Version: b.Version.String(), CsvName: b.Name}
+		}
+		nodes := map[registry.BundleKey]map[registry.BundleKey]struct{}{}
+		for _, b := range ch.Bundles {
+			edges := map[registry.BundleKey]struct{}{}
+			if b.Replaces != "" {
+				if key, ok := keys[b.Replaces]; ok {
+					edges[key] = struct{}{}
+				} else {
+					edges[registry.BundleKey{CsvName: b.Replaces}] = struct{}{}
+				}
+			}
+			for _, skip := range b.Skips {
+				edges[registry.BundleKey{CsvName: skip}] = struct{}{}
+			}
+			nodes[keys[b.Name]] = edges
+		}
+		var head registry.BundleKey
+		if h, err := ch.Head(); err == nil {
+			head = keys[h.Name]
+		}
+		graph.Channels[ch.Name] = registry.Channel{Head: head, Nodes: nodes}
+	}
+	return graph
+}
+
+func sortedPackages(m model.Model) []*model.Package {
+	pkgs := make([]*model.Package, 0, len(m))
+	for _, pkg := range m {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Slice(pkgs, func(i, j int) bool {
+		return pkgs[i].Name < pkgs[j].Name
+	})
+	return pkgs
+}
@@ -0,0 +1,463 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/operator-framework/operator-registry/alpha/model"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"sigs.k8s.io/yaml"
+
+	"github.com/release-engineering/dcm/internal/version"
+)
+
+// LintSeverity is the severity of the findings of a lint rule.
+type LintSeverity string
+
+const (
+	LintSeverityError   LintSeverity = "error"
+	LintSeverityWarning LintSeverity = "warning"
+	LintSeverityNote    LintSeverity = "note"
+	// LintSeverityOff disables a rule.
+	LintSeverityOff LintSeverity = "off"
+)
+
+// UnmarshalJSON accepts "false" as LintSeverityOff, as YAML parses an
+// unquoted off as a boolean.
+func (s *LintSeverity) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return err
+	}
+	if str == "false" {
+		str = string(LintSeverityOff)
+	}
+	*s = LintSeverity(str)
+	return nil
+}
+
+// LintFormat is the format of a lint report.
+type LintFormat string
+
+const (
+	LintFormatText  LintFormat = "text"
+	LintFormatJSON  LintFormat = "json"
+	LintFormatSARIF LintFormat = "sarif"
+)
+
+// LintConfig configures the built-in lint rules, by rule ID. Rules that are
+// not listed run with their default severity.
+type LintConfig struct {
+	Rules map[string]LintRuleConfig `json:"rules,omitempty"`
+}
+
+// LintRuleConfig configures a single lint rule.
+type LintRuleConfig struct {
+	Severity LintSeverity `json:"severity,omitempty"`
+	// Pattern is the regular expression that names must match, for the
+	// rules that check names.
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// LoadLintConfig reads a lint configuration from a YAML or JSON file.
+func LoadLintConfig(filename string) (*LintConfig, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read lint config: %w", err)
+	}
+	var c LintConfig
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, fmt.Errorf("parse lint config %q: %w", filename, err)
+	}
+	return &c, nil
+}
+
+// LintFinding is a violation of a lint rule. Package, Channel and Bundle
+// locate it in the catalog.
+type LintFinding struct {
+	Rule     string       `json:"rule"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+	Package  string       `json:"package,omitempty"`
+	Channel  string       `json:"channel,omitempty"`
+	Bundle   string       `json:"bundle,omitempty"`
+}
+
+// location returns the logical location of the finding, such as
+// "<package>/<channel>" or "<package>/<bundle>".
+func (f LintFinding) location() string {
+	switch {
+	case f.Channel != "":
+		return f.Package + "/" + f.Channel
+	case f.Bundle != "":
+		return f.Package + "/" + f.Bundle
+	}
+	return f.Package
+}
+
+// lintRule is a built-in lint rule. check reports the findings of the rule
+// in m, without their severity.
+type lintRule struct {
+	ID          string
+	Description string
+	Severity    LintSeverity
+	check       func(m model.Model, cfg LintRuleConfig) ([]LintFinding, error)
+}
+
+var lintRules = []lintRule{
+	{
+		ID:          "channel-name",
+		Description: "Channel names match the configured pattern, by default stable, fast or candidate-*",
+		Severity:    LintSeverityError,
+		check:       lintChannelNames,
+	},
+	{
+		ID:          "head-bundle-objects",
+		Description: "Channel heads carry their olm.bundle.object properties",
+		Severity:    LintSeverityError,
+		check:       lintHeadBundleObjects,
+	},
+	{
+		ID:          "no-latest-tag",
+		Description: "Bundle images and related images are not referenced by the latest tag, explicitly or implicitly",
+		Severity:    LintSeverityError,
+		check:       lintLatestTags,
+	},
+	{
+		ID:          "pinned-images",
+		Description: "Bundle images and related images are referenced by digest",
+		Severity:    LintSeverityError,
+		check:       lintPinnedImages,
+	},
+}
+
+const defaultChannelNamePattern = `^(stable|fast|candidate-.+)$`
+
+// Lint checks a declarative config directory against rules that go beyond
+// OLM validity, such as organisational policies on image references and
+// channel names, and writes a report of the findings.
+type Lint struct {
+	FromDir string
+	Config  LintConfig
+	Format  LintFormat
+
+	Writer io.Writer
+}
+
+func (l Lint) Run(_ context.Context) error {
+	for id, rc := range l.Config.Rules {
+		if findLintRule(id) == nil {
+			return fmt.Errorf("unknown lint rule %q", id)
+		}
+		switch rc.Severity {
+		case "", LintSeverityError, LintSeverityWarning, LintSeverityNote, LintSeverityOff:
+		default:
+			return fmt.Errorf("invalid severity %q of lint rule %q", rc.Severity, id)
+		}
+	}
+	switch l.Format {
+	case "", LintFormatText, LintFormatJSON, LintFormatSARIF:
+	default:
+		return fmt.Errorf("unknown lint report format %q", l.Format)
+	}
+
+	m, err := loadModel(l.FromDir)
+	if err != nil {
+		return err
+	}
+
+	findings := []LintFinding{}
+	for _, r := range lintRules {
+		rc := l.Config.Rules[r.ID]
+		severity := r.Severity
+		if rc.Severity != "" {
+			severity = rc.Severity
+		}
+		if severity == LintSeverityOff {
+			continue
+		}
+		rf, err := r.check(m, rc)
+		if err != nil {
+			return fmt.Errorf("lint rule %q: %w", r.ID, err)
+		}
+		for _, f := range rf {
+			f.Rule = r.ID
+			f.Severity = severity
+			findings = append(findings, f)
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].location() < findings[j].location()
+	})
+
+	switch l.Format {
+	case LintFormatJSON:
+		err = writeJSON(l.Writer, findings)
+	case LintFormatSARIF:
+		err = writeJSON(l.Writer, newSARIFLog(findings))
+	default:
+		err = writeLintText(l.Writer, findings)
+	}
+	if err != nil {
+		return fmt.Errorf("write lint report: %w", err)
+	}
+
+	failed := 0
+	for _, f := range findings {
+		if f.Severity == LintSeverityError {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return classify(ErrLintFailed, fmt.Errorf("catalog %q has %d lint findings of severity error", l.FromDir, failed))
+	}
+	return nil
+}
+
+func findLintRule(id string) *lintRule {
+	for i, r := range lintRules {
+		if r.ID == id {
+			return &lintRules[i]
+		}
+	}
+	return nil
+}
+
+func lintChannelNames(m model.Model, cfg LintRuleConfig) ([]LintFinding, error) {
+	pattern := cfg.Pattern
+	if pattern == "" {
+		pattern = defaultChannelNamePattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("compile pattern %q: %w", pattern, err)
+	}
+	var findings []LintFinding
+	for _, pkg := range m {
+		for _, ch := range pkg.Channels {
+			if !re.MatchString(ch.Name) {
+				findings = append(findings, LintFinding{
+					Message: fmt.Sprintf("channel name %q does not match %q", ch.Name, pattern),
+					Package: pkg.Name,
+					Channel: ch.Name,
+				})
+			}
+		}
+	}
+	return findings, nil
+}
+
+func lintHeadBundleObjects(m model.Model, _ LintRuleConfig) ([]LintFinding, error) {
+	var findings []LintFinding
+	for _, pkg := range m {
+		for _, ch := range pkg.Channels {
+			head, err := ch.Head()
+			if err != nil {
+				return nil, fmt.Errorf("get head of channel %q in package %q: %w", ch.Name, pkg.Name, err)
+			}
+			hasObjects := false
+			for _, p := range head.Properties {
+				if p.Type == property.TypeBundleObject {
+					hasObjects = true
+					break
+				}
+			}
+			if !hasObjects {
+				findings = append(findings, LintFinding{
+					Message: fmt.Sprintf("bundle %q, the head of channel %q, has no olm.bundle.object properties", head.Name, ch.Name),
+					Package: pkg.Name,
+					Channel: ch.Name,
+					Bundle:  head.Name,
+				})
+			}
+		}
+	}
+	return findings, nil
+}
+
+func lintLatestTags(m model.Model, _ LintRuleConfig) ([]LintFinding, error) {
+	return lintImages(m, func(img string, ref docker.Reference) string {
+		if _, ok := ref.(docker.Digested); ok {
+			return ""
+		}
+		tagged, ok := ref.(docker.Tagged)
+		if !ok {
+			return fmt.Sprintf("image %q has no tag, and implicitly refers to the latest tag", img)
+		}
+		if tagged.Tag() == "latest" {
+			return fmt.Sprintf("image %q refers to the latest tag", img)
+		}
+		return ""
+	})
+}
+
+func lintPinnedImages(m model.Model, _ LintRuleConfig) ([]LintFinding, error) {
+	return lintImages(m, func(img string, ref docker.Reference) string {
+		if _, ok := ref.(docker.Digested); ok {
+			return ""
+		}
+		return fmt.Sprintf("image %q is not referenced by digest", img)
+	})
+}
+
+// lintImages reports a finding for every bundle image and related image for
+// which check returns a message. Images that cannot be parsed are always
+// reported.
+func lintImages(m model.Model, check func(img string, ref docker.Reference) string) ([]LintFinding, error) {
+	var findings []LintFinding
+	for _, pkg := range m {
+		for _, b := range uniqueBundles(pkg) {
+			images := []string{b.Image}
+			for _, ri := range b.RelatedImages {
+				if ri.Image != b.Image {
+					images = append(images, ri.Image)
+				}
+			}
+			for _, img := range images {
+				if img == "" {
+					continue
+				}
+				var msg string
+				ref, err := docker.Parse(img)
+				if err != nil {
+					msg = fmt.Sprintf("image %q cannot be parsed: %v", img, err)
+				} else {
+					msg = check(img, ref)
+				}
+				if msg != "" {
+					findings = append(findings, LintFinding{
+						Message: msg,
+						Package: pkg.Name,
+						Bundle:  b.Name,
+					})
+				}
+			}
+		}
+	}
+	return findings, nil
+}
+
+// uniqueBundles returns the bundles of pkg sorted by name. A bundle that is
+// a member of several channels is returned once.
+func uniqueBundles(pkg *model.Package) []*model.Bundle {
+	byName := map[string]*model.Bundle{}
+	for _, ch := range pkg.Channels {
+		for _, b := range ch.Bundles {
+			byName[b.Name] = b
+		}
+	}
+	bundles := make([]*model.Bundle, 0, len(byName))
+	for _, b := range byName {
+		bundles = append(bundles, b)
+	}
+	sort.Slice(bundles, func(i, j int) bool {
+		return bundles[i].Name < bundles[j].Name
+	})
+	return bundles
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeLintText(w io.Writer, findings []LintFinding) error {
+	ew := &errWriter{w: w}
+	for _, f := range findings {
+		ew.printf("%s[%s] %s: %s\n", f.Severity, f.Rule, f.location(), f.Message)
+	}
+	return ew.err
+}
+
+// The subset of the SARIF 2.1.0 format written by Lint.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifLocation struct {
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+}
+
+func newSARIFLog(findings []LintFinding) sarifLog {
+	driver := sarifDriver{
+		Name:           "dcm",
+		Version:        version.GitVersion,
+		InformationURI: "https://github.com/release-engineering/dcm",
+	}
+	for _, r := range lintRules {
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   r.ID,
+			ShortDescription:     sarifMessage{Text: r.Description},
+			DefaultConfiguration: sarifConfiguration{Level: string(r.Severity)},
+		})
+	}
+	results := []sarifResult{}
+	for _, f := range findings {
+		results = append(results, sarifResult{
+			RuleID:  f.Rule,
+			Level:   string(f.Severity),
+			Message: sarifMessage{Text: f.Message},
+			Locations: []sarifLocation{{
+				LogicalLocations: []sarifLogicalLocation{{FullyQualifiedName: f.location()}},
+			}},
+		})
+	}
+	return sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: driver},
+			Results: results,
+		}},
+	}
+}
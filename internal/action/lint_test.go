@@ -0,0 +1,185 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"sigs.k8s.io/yaml"
+)
+
+func TestLintRules(t *testing.T) {
+	type spec struct {
+		name   string
+		rule   string
+		config LintRuleConfig
+		// setup changes the test catalog before it is linted, when not nil.
+		setup func(fbc *declcfg.DeclarativeConfig)
+		// expectLocations are the locations of the expected findings.
+		expectLocations []string
+	}
+	specs := []spec{
+		{
+			name: "ChannelNameDefaultPattern",
+			rule: "channel-name",
+			setup: func(fbc *declcfg.DeclarativeConfig) {
+				fbc.Channels = append(fbc.Channels, declcfg.Channel{Schema: "olm.channel", Package: "foo", Name: "beta", Entries: []declcfg.ChannelEntry{{Name: "foo.v0.3.0"}}})
+			},
+			expectLocations: []string{"foo/beta"},
+		},
+		{
+			name:            "ChannelNameConfiguredPattern",
+			rule:            "channel-name",
+			config:          LintRuleConfig{Pattern: "^stable$"},
+			expectLocations: []string{"foo/fast"},
+		},
+		{
+			name: "HeadBundleObjects",
+			rule: "head-bundle-objects",
+			setup: func(fbc *declcfg.DeclarativeConfig) {
+				b, _ := findBundle(fbc.Bundles, "foo.v0.3.0")
+				b.Properties = withoutBundleObjects(b.Properties)
+				// Bundles that are not heads need no objects.
+				b, _ = findBundle(fbc.Bundles, "foo.v0.1.0")
+				b.Properties = withoutBundleObjects(b.Properties)
+			},
+			expectLocations: []string{"foo/fast"},
+		},
+		{
+			name: "LatestTags",
+			rule: "no-latest-tag",
+			setup: func(fbc *declcfg.DeclarativeConfig) {
+				fbc.Bundles[0].Image = "quay.io/example/foo-bundle"
+				fbc.Bundles[1].Image = "quay.io/example/foo-bundle:latest"
+			},
+			expectLocations: []string{"foo/foo.v0.1.0", "foo/foo.v0.2.0"},
+		},
+		{
+			name: "PinnedImages",
+			rule: "pinned-images",
+			setup: func(fbc *declcfg.DeclarativeConfig) {
+				fbc.Bundles[0].Image = "quay.io/example/foo-bundle@sha256:0000000000000000000000000000000000000000000000000000000000000000"
+			},
+			expectLocations: []string{"foo/foo.v0.2.0", "foo/foo.v0.3.0"},
+		},
+		{
+			name:            "NoFindings",
+			rule:            "channel-name",
+			expectLocations: nil,
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			fbc := testCatalog()
+			if s.setup != nil {
+				s.setup(fbc)
+			}
+			m, err := declcfg.ConvertToModel(*fbc)
+			if err != nil {
+				t.Fatalf("convert test catalog: %v", err)
+			}
+			findings, err := findLintRule(s.rule).check(m, s.config)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var locations []string
+			for _, f := range findings {
+				locations = append(locations, f.location())
+			}
+			sort.Strings(locations)
+			if !reflect.DeepEqual(locations, s.expectLocations) {
+				t.Errorf("expected findings at %v, got %v", s.expectLocations, locations)
+			}
+		})
+	}
+}
+
+func TestLintSeverities(t *testing.T) {
+	type spec struct {
+		name string
+		// config is the YAML lint configuration.
+		config      string
+		expectErr   bool
+		expectClass error
+		// expectSeverities are the severities of the findings, by rule.
+		expectSeverities map[string]LintSeverity
+	}
+	specs := []spec{
+		{
+			name:             "Default",
+			expectClass:      ErrLintFailed,
+			expectSeverities: map[string]LintSeverity{"pinned-images": LintSeverityError},
+		},
+		{
+			name:             "Warning",
+			config:           "rules: {pinned-images: {severity: warning}}",
+			expectSeverities: map[string]LintSeverity{"pinned-images": LintSeverityWarning},
+		},
+		{
+			name:             "Off",
+			config:           "rules: {pinned-images: {severity: off}}",
+			expectSeverities: map[string]LintSeverity{},
+		},
+		{
+			name:             "ErrorOnOtherRule",
+			config:           "rules: {pinned-images: {severity: note}, channel-name: {pattern: '^stable$'}}",
+			expectClass:      ErrLintFailed,
+			expectSeverities: map[string]LintSeverity{"pinned-images": LintSeverityNote, "channel-name": LintSeverityError},
+		},
+		{
+			name:      "UnknownRule",
+			config:    "rules: {no-such-rule: {severity: warning}}",
+			expectErr: true,
+		},
+		{
+			name:      "InvalidSeverity",
+			config:    "rules: {pinned-images: {severity: fatal}}",
+			expectErr: true,
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := writeToFS(*testCatalog(), dir, declcfg.WriteYAML); err != nil {
+				t.Fatal(err)
+			}
+			var config LintConfig
+			if err := yaml.UnmarshalStrict([]byte(s.config), &config); err != nil {
+				t.Fatalf("parse config: %v", err)
+			}
+			var out bytes.Buffer
+			l := Lint{FromDir: dir, Config: config, Format: LintFormatJSON, Writer: &out}
+
+			err := l.Run(context.Background())
+			if s.expectErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if s.expectClass != nil {
+				if !errors.Is(err, s.expectClass) {
+					t.Fatalf("expected error %v, got %v", s.expectClass, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			var findings []LintFinding
+			if err := json.Unmarshal(out.Bytes(), &findings); err != nil {
+				t.Fatalf("parse report: %v", err)
+			}
+			severities := map[string]LintSeverity{}
+			for _, f := range findings {
+				severities[f.Rule] = f.Severity
+			}
+			if !reflect.DeepEqual(severities, s.expectSeverities) {
+				t.Errorf("expected severities %v, got %v", s.expectSeverities, severities)
+			}
+		})
+	}
+}
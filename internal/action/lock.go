@@ -0,0 +1,160 @@
+package action
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/joelanford/ignore"
+	"github.com/sirupsen/logrus"
+)
+
+// catalogLockFile is the advisory lock file, in the root of a declarative
+// config directory, that commands modifying the directory hold while they
+// run.
+const catalogLockFile = ".dcm.lock"
+
+// lockPollInterval is the interval at which a held lock is retried when
+// waiting with a timeout.
+const lockPollInterval = 100 * time.Millisecond
+
+// lockWaitForever makes lockFile wait for a lock without a timeout.
+const lockWaitForever time.Duration = -1
+
+// lockCatalog acquires the lock of the declarative config directory dir,
+// waiting at most timeout for other processes to release it. The returned
+// function releases the lock.
+func lockCatalog(dir string, timeout time.Duration, log *logrus.Logger) (func(), error) {
+	unlock, err := lockFile(filepath.Join(dir, catalogLockFile), true, timeout, func() {
+		log.WithField("dir", dir).Infof("waiting up to %s for another process to release the catalog lock", timeout)
+	})
+	if errors.Is(err, ErrLocked) {
+		return nil, classify(ErrLocked, fmt.Errorf("declarative config directory %q is locked by another process", dir))
+	}
+	if err != nil {
+		return nil, classify(ErrInvalidInput, err)
+	}
+	if err := recoverDir(dir, log); err != nil {
+		unlock()
+		return nil, err
+	}
+	return unlock, nil
+}
+
+// lockFile acquires an advisory lock on the file at path, creating it if
+// necessary. It waits at most timeout for other processes to release the
+// lock, or as long as it takes with lockWaitForever, and calls onWait, if not
+// nil, when it starts waiting. An error of class ErrLocked is returned on
+// timeout. The returned function releases the lock.
+func lockFile(path string, exclusive bool, timeout time.Duration, onWait func()) (func(), error) {
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	deadline := time.Now().Add(timeout)
+	for waiting := false; ; {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+		if err != nil {
+			return nil, fmt.Errorf("open lock file %q: %w", path, err)
+		}
+		err = syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB)
+		if errors.Is(err, syscall.EWOULDBLOCK) && timeout == lockWaitForever {
+			if !waiting && onWait != nil {
+				onWait()
+			}
+			waiting = true
+			err = syscall.Flock(int(f.Fd()), how)
+		}
+		if err == nil {
+			// The lock file may have been removed and created again while
+			// waiting: a lock on the previous file protects nothing.
+			if current(f, path) {
+				return func() {
+					_ = syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+					f.Close()
+				}, nil
+			}
+			f.Close()
+			continue
+		}
+		f.Close()
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, fmt.Errorf("lock %q: %w", path, err)
+		}
+		if time.Now().After(deadline) {
+			return nil, classify(ErrLocked, fmt.Errorf("%q is locked by another process", path))
+		}
+		if !waiting && onWait != nil {
+			onWait()
+		}
+		waiting = true
+		time.Sleep(lockPollInterval)
+	}
+}
+
+// current reports whether the open file f is still the file at path.
+func current(f *os.File, path string) bool {
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	pi, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(fi, pi)
+}
+
+// catalogHash returns a hash of the paths and contents of the files of the
+// declarative config directory dir that are loaded as part of the catalog,
+// and of its .indexignore files: hidden entries, such as the lock file and
+// VCS metadata, and the files matched by .indexignore are skipped.
+func catalogHash(dir string) (string, error) {
+	fsys := catalogFS(dir)
+	matcher, err := ignore.NewMatcher(fsys, indexIgnoreFile)
+	if err != nil {
+		return "", fmt.Errorf("read %s files of %q: %w", indexIgnoreFile, dir, err)
+	}
+	var paths []string
+	err = fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || (d.Name() != indexIgnoreFile && matcher.Match(path, false)) {
+			return nil
+		}
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("walk %q: %w", dir, err)
+	}
+	sort.Strings(paths)
+
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s\x00", path)
+		if err := hashFile(h, fsys, path); err != nil {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, fsys fs.FS, path string) error {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,192 @@
+package action
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/sirupsen/logrus"
+)
+
+func TestLockCatalog(t *testing.T) {
+	dir := t.TempDir()
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+
+	unlock, err := lockCatalog(dir, 0, log)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := lockCatalog(dir, 0, log); !errors.Is(err, ErrLocked) {
+		t.Fatalf("expected error %v while the lock is held, got %v", ErrLocked, err)
+	}
+	unlock()
+	unlock, err = lockCatalog(dir, 0, log)
+	if err != nil {
+		t.Fatalf("unexpected error once the lock is released: %v", err)
+	}
+	unlock()
+
+	if _, err := lockCatalog(filepath.Join(dir, "missing"), 0, log); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("expected error %v for a missing directory, got %v", ErrInvalidInput, err)
+	}
+}
+
+func TestCatalogHash(t *testing.T) {
+	type spec struct {
+		name string
+		// change changes the catalog in dir.
+		change       func(t *testing.T, dir string)
+		expectChange bool
+	}
+	specs := []spec{
+		{
+			name: "CatalogFile",
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, "foo", "catalog.yaml"), "")
+			},
+			expectChange: true,
+		},
+		{
+			name: "NewCatalogFile",
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, "bar", "catalog.yaml"), "")
+			},
+			expectChange: true,
+		},
+		{
+			name: "IndexIgnore",
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, ".indexignore"), "docs\nfoo/*.md\n")
+			},
+			expectChange: true,
+		},
+		{
+			name: "LockFile",
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, catalogLockFile), "pid")
+			},
+		},
+		{
+			name: "HiddenDirectory",
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main")
+				writeTestFile(t, filepath.Join(dir, stagingPrefix+"test", stagingNew, "foo", "catalog.yaml"), "")
+			},
+		},
+		{
+			name: "IgnoredFiles",
+			change: func(t *testing.T, dir string) {
+				writeTestFile(t, filepath.Join(dir, "docs", "README.md"), "changed")
+				writeTestFile(t, filepath.Join(dir, "foo", "NOTES.md"), "changed")
+			},
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := writeToFS(*testCatalog(), dir, declcfg.WriteYAML); err != nil {
+				t.Fatal(err)
+			}
+			writeTestFile(t, filepath.Join(dir, ".indexignore"), "docs\n*.md\n")
+			writeTestFile(t, filepath.Join(dir, "docs", "README.md"), "")
+			before, err := catalogHash(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s.change(t, dir)
+			after, err := catalogHash(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := after != before; changed != s.expectChange {
+				t.Errorf("expected hash change %v, got %v", s.expectChange, changed)
+			}
+		})
+	}
+}
+
+func TestMutateFBC(t *testing.T) {
+	type spec struct {
+		name string
+		// mutate is applied to the catalog loaded from dir.
+		mutate      func(t *testing.T, dir string, fbc *declcfg.DeclarativeConfig) error
+		expectClass error
+		// expectDefaultChannel is the default channel of the catalog in dir
+		// after the run.
+		expectDefaultChannel string
+	}
+	specs := []spec{
+		{
+			name: "Written",
+			mutate: func(t *testing.T, dir string, fbc *declcfg.DeclarativeConfig) error {
+				fbc.Packages[0].DefaultChannel = "fast"
+				return nil
+			},
+			expectDefaultChannel: "fast",
+		},
+		{
+			name: "ChangedByOtherProcess",
+			mutate: func(t *testing.T, dir string, fbc *declcfg.DeclarativeConfig) error {
+				fbc.Packages[0].DefaultChannel = "fast"
+				writeTestFile(t, filepath.Join(dir, "extra.yaml"), "")
+				return nil
+			},
+			expectClass:          ErrCatalogChanged,
+			expectDefaultChannel: "stable",
+		},
+		{
+			name: "HiddenFileChangedByOtherProcess",
+			mutate: func(t *testing.T, dir string, fbc *declcfg.DeclarativeConfig) error {
+				fbc.Packages[0].DefaultChannel = "fast"
+				writeTestFile(t, filepath.Join(dir, ".git", "HEAD"), "ref: refs/heads/main")
+				return nil
+			},
+			expectDefaultChannel: "fast",
+		},
+		{
+			name: "InvalidResult",
+			mutate: func(t *testing.T, dir string, fbc *declcfg.DeclarativeConfig) error {
+				fbc.Packages[0].DefaultChannel = "beta"
+				return nil
+			},
+			expectClass:          ErrInvalidResult,
+			expectDefaultChannel: "stable",
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if _, err := writeToFS(*testCatalog(), dir, declcfg.WriteYAML); err != nil {
+				t.Fatal(err)
+			}
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+
+			_, err := mutateFBC(dir, 0, log, func(fbc *declcfg.DeclarativeConfig) error {
+				return s.mutate(t, dir, fbc)
+			})
+			if s.expectClass != nil {
+				if !errors.Is(err, s.expectClass) {
+					t.Fatalf("expected error %v, got %v", s.expectClass, err)
+				}
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			// The catalog is read back as another command would, so that
+			// nothing is left behind that breaks it.
+			os.Remove(filepath.Join(dir, "extra.yaml"))
+			fbc, err := loadFBC(dir)
+			if err != nil {
+				t.Fatalf("load catalog: %v", err)
+			}
+			if dc := fbc.Packages[0].DefaultChannel; dc != s.expectDefaultChannel {
+				t.Errorf("expected default channel %q, got %q", s.expectDefaultChannel, dc)
+			}
+		})
+	}
+}
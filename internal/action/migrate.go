@@ -3,34 +3,42 @@ package action
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 
+	"github.com/joelanford/ignore"
 	"github.com/operator-framework/operator-registry/alpha/action"
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
 	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
 )
 
 type Migrate struct {
 	IndexImage string
 	OutputDir  string
 
-	WriteFunc WriteFunc
-	Registry  image.Registry
+	WriteFunc       WriteFunc
+	Registry        image.Registry
+	RegistryOptions RegistryOptions
+	Log             *logrus.Logger
 }
 
 type WriteFunc func(config declcfg.DeclarativeConfig, w io.Writer) error
 
-func (m Migrate) Run(ctx context.Context) error {
+func (m Migrate) Run(ctx context.Context) (*Result, error) {
 	entries, err := ioutil.ReadDir(m.OutputDir)
 	if err != nil && !os.IsNotExist(err) {
-		return err
+		return nil, err
 	}
 	if len(entries) > 0 {
-		return fmt.Errorf("output dir %q must be empty", m.OutputDir)
+		return nil, classify(ErrOutputNotEmpty, fmt.Errorf("output dir %q must be empty", m.OutputDir))
 	}
 
 	r := action.Render{
@@ -39,21 +47,48 @@ func (m Migrate) Run(ctx context.Context) error {
 	}
 	if m.Registry != nil {
 		r.Registry = m.Registry
+	} else {
+		reg, err := newRegistry(m.RegistryOptions, m.Log)
+		if err != nil {
+			return nil, fmt.Errorf("create temporary image registry: %w", err)
+		}
+		defer destroyRegistry(reg, m.Log)
+		r.Registry = reg
 	}
 
-	fmt.Printf("rendering image %q as declarative config\n", m.IndexImage)
+	m.Log.WithField("image", m.IndexImage).Info("rendering index image as declarative config")
 	cfg, err := r.Run(ctx)
 	if err != nil {
-		return fmt.Errorf("render index image: %v", err)
+		return nil, fmt.Errorf("render index image: %w", err)
 	}
 
-	fmt.Printf("writing rendered declarative config to %q\n", m.OutputDir)
-	return writeToFS(*cfg, m.OutputDir, m.WriteFunc)
+	m.Log.WithField("dir", m.OutputDir).Info("writing rendered declarative config")
+	res := diffCatalogs(catalogSnapshot{}, snapshotCatalog(cfg))
+	if res.FilesWritten, err = writeToFS(*cfg, m.OutputDir, m.WriteFunc); err != nil {
+		return nil, err
+	}
+	return res, nil
 }
 
 const globalName = "__global"
 
-func writeToFS(cfg declcfg.DeclarativeConfig, rootDir string, writeFunc WriteFunc) error {
+// writeToFS writes cfg to rootDir, one directory per package, and returns the
+// names of the files written. Other directories of rootDir, hidden entries,
+// such as an .indexignore file, and files ignored by .indexignore are kept.
+func writeToFS(cfg declcfg.DeclarativeConfig, rootDir string, writeFunc WriteFunc) ([]string, error) {
+	return writeTree(cfg, rootDir, writeFunc, false)
+}
+
+// writeTree is writeToFS, but with removeOthers the entries of rootDir that
+// are neither written nor hidden are removed.
+//
+// The package directories and global file are written to a hidden staging
+// directory in rootDir first, and only once they are all complete are they
+// renamed over the entries of rootDir, so that an error never leaves rootDir
+// with some packages updated and others not. rootDir itself stays in place.
+// If the process is killed while entries are renamed, recoverDir completes
+// the write.
+func writeTree(cfg declcfg.DeclarativeConfig, rootDir string, writeFunc WriteFunc, removeOthers bool) ([]string, error) {
 	channelsByPackage := map[string][]declcfg.Channel{}
 	for _, c := range cfg.Channels {
 		channelsByPackage[c.Package] = append(channelsByPackage[c.Package], c)
@@ -72,9 +107,30 @@ func writeToFS(cfg declcfg.DeclarativeConfig, rootDir string, writeFunc WriteFun
 	}
 
 	if err := os.MkdirAll(rootDir, 0777); err != nil {
-		return fmt.Errorf("mkdir %q: %v", rootDir, err)
+		return nil, fmt.Errorf("mkdir %q: %w", rootDir, err)
+	}
+	stagingDir, err := os.MkdirTemp(rootDir, stagingPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("create staging directory in %q: %w", rootDir, err)
+	}
+	defer os.RemoveAll(stagingDir)
+	// Other tools loading the catalog, such as opm, do not skip hidden
+	// directories: the staging directory is excluded with an .indexignore
+	// file of its own.
+	if err := writeRawFile(filepath.Join(stagingDir, indexIgnoreFile), []byte("*\n")); err != nil {
+		return nil, err
+	}
+	newDir := filepath.Join(stagingDir, stagingNew)
+	for _, d := range []string{newDir, filepath.Join(stagingDir, stagingOld)} {
+		if err := os.Mkdir(d, 0777); err != nil {
+			return nil, err
+		}
 	}
 
+	var (
+		written []string
+		journal []journalEntry
+	)
 	for _, p := range cfg.Packages {
 		fcfg := declcfg.DeclarativeConfig{
 			Packages: []declcfg.Package{p},
@@ -82,38 +138,290 @@ func writeToFS(cfg declcfg.DeclarativeConfig, rootDir string, writeFunc WriteFun
 			Bundles:  bundlesByPackage[p.Name],
 			Others:   othersByPackage[p.Name],
 		}
-		pkgDir := filepath.Join(rootDir, p.Name)
-		if err := os.RemoveAll(pkgDir); err != nil {
-			return err
+		// The package is entirely described by the file written here, so
+		// the other files of its previous directory are stale.
+		if err := mkdirLike(filepath.Join(newDir, p.Name), filepath.Join(rootDir, p.Name)); err != nil {
+			return nil, err
 		}
-		if err := os.MkdirAll(pkgDir, 0777); err != nil {
-			return err
+		filename := filepath.Join(p.Name, "catalog.yaml")
+		if err := writeFile(fcfg, filepath.Join(newDir, filename), writeFunc); err != nil {
+			return nil, err
 		}
-		filename := filepath.Join(pkgDir, "catalog.yaml")
-		if err := writeFile(fcfg, filename, writeFunc); err != nil {
-			return err
+		journal = append(journal, journalEntry{op: journalReplace, name: p.Name})
+		written = append(written, filepath.Join(rootDir, filename))
+	}
+
+	// Blobs scoped to a package that is not in the catalog are written to the
+	// directory of that package all the same, so that they are kept.
+	packages := sets.NewString(globalName)
+	for _, p := range cfg.Packages {
+		packages.Insert(p.Name)
+	}
+	var orphaned []string
+	for pkgName := range othersByPackage {
+		if !packages.Has(pkgName) {
+			orphaned = append(orphaned, pkgName)
+		}
+	}
+	sort.Strings(orphaned)
+	for _, pkgName := range orphaned {
+		if err := mkdirLike(filepath.Join(newDir, pkgName), filepath.Join(rootDir, pkgName)); err != nil {
+			return nil, err
+		}
+		filename := filepath.Join(pkgName, "catalog.yaml")
+		if err := writeFile(declcfg.DeclarativeConfig{Others: othersByPackage[pkgName]}, filepath.Join(newDir, filename), writeFunc); err != nil {
+			return nil, err
 		}
+		journal = append(journal, journalEntry{op: journalReplace, name: pkgName})
+		written = append(written, filepath.Join(rootDir, filename))
 	}
 
 	if globals, ok := othersByPackage[globalName]; ok {
+		filename := fmt.Sprintf("%s.yaml", globalName)
 		gcfg := declcfg.DeclarativeConfig{
 			Others: globals,
 		}
-		filename := filepath.Join(rootDir, fmt.Sprintf("%s.yaml", globalName))
-		if err := writeFile(gcfg, filename, writeFunc); err != nil {
+		if err := writeFile(gcfg, filepath.Join(newDir, filename), writeFunc); err != nil {
+			return nil, err
+		}
+		journal = append(journal, journalEntry{op: journalReplace, name: filename})
+		written = append(written, filepath.Join(rootDir, filename))
+	}
+
+	// Other files in the root of rootDir that are not ignored by .indexignore
+	// were loaded as part of the catalog, and their contents are written
+	// above: they are removed so that nothing is loaded twice.
+	matcher, err := ignore.NewMatcher(catalogFS(rootDir), indexIgnoreFile)
+	if err != nil {
+		return nil, fmt.Errorf("read %s files of %q: %w", indexIgnoreFile, rootDir, err)
+	}
+	replaced := map[string]bool{}
+	for _, e := range journal {
+		replaced[e.name] = true
+	}
+	entries, err := os.ReadDir(rootDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if replaced[e.Name()] || isHidden(e.Name()) {
+			continue
+		}
+		if removeOthers || (!e.IsDir() && !matcher.Match(e.Name(), false)) {
+			journal = append(journal, journalEntry{op: journalRemove, name: e.Name()})
+		}
+	}
+
+	if err := writeJournal(stagingDir, journal); err != nil {
+		return nil, err
+	}
+	if err := swapEntries(rootDir, stagingDir, journal); err != nil {
+		if rerr := rollbackEntries(rootDir, stagingDir, journal); rerr != nil {
+			return nil, fmt.Errorf("write %q: %v; roll back: %w", rootDir, err, rerr)
+		}
+		return nil, fmt.Errorf("write %q: %w", rootDir, err)
+	}
+	return written, nil
+}
+
+// stagingPrefix is the prefix of the hidden directories, in the root of a
+// declarative config directory, in which writeTree stages its entries.
+// Hidden entries are not part of the catalog, so they are never loaded.
+const stagingPrefix = ".dcm-staging-"
+
+// A staging directory holds the new entries, the previous entries once they
+// are moved aside, and the journal of the entries to swap.
+const (
+	stagingNew     = "new"
+	stagingOld     = "old"
+	stagingJournal = "journal"
+)
+
+const (
+	journalReplace = "replace"
+	journalRemove  = "remove"
+)
+
+// journalEntry is an entry of the root directory that writeTree replaces
+// with the entry of the same name in the staging directory, or removes.
+type journalEntry struct {
+	op   string
+	name string
+}
+
+// writeJournal writes the journal of stagingDir. The journal is written once
+// all new entries are staged, so a staging directory with a journal is
+// complete and recoverDir swaps it in.
+func writeJournal(stagingDir string, journal []journalEntry) error {
+	var buf bytes.Buffer
+	for _, e := range journal {
+		fmt.Fprintf(&buf, "%s %s\n", e.op, e.name)
+	}
+	return writeRawFile(filepath.Join(stagingDir, stagingJournal), buf.Bytes())
+}
+
+// readJournal reads the journal of stagingDir. It returns an error wrapping
+// os.ErrNotExist if stagingDir has no journal.
+func readJournal(stagingDir string) ([]journalEntry, error) {
+	data, err := os.ReadFile(filepath.Join(stagingDir, stagingJournal))
+	if err != nil {
+		return nil, err
+	}
+	var journal []journalEntry
+	for _, line := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || (fields[0] != journalReplace && fields[0] != journalRemove) || fields[1] == "" || strings.ContainsRune(fields[1], filepath.Separator) {
+			return nil, fmt.Errorf("invalid journal entry %q in %q", line, stagingDir)
+		}
+		journal = append(journal, journalEntry{op: fields[0], name: fields[1]})
+	}
+	return journal, nil
+}
+
+// swapEntries moves the entries of rootDir listed in journal aside to the
+// staging directory, moves the new entries in their place, and removes the
+// staging directory with the previous entries. Entries that were swapped
+// already are skipped, so that recoverDir may complete an interrupted swap.
+func swapEntries(rootDir, stagingDir string, journal []journalEntry) error {
+	for _, e := range journal {
+		target := filepath.Join(rootDir, e.name)
+		newPath := filepath.Join(stagingDir, stagingNew, e.name)
+		oldPath := filepath.Join(stagingDir, stagingOld, e.name)
+		if e.op == journalReplace {
+			if _, err := os.Lstat(newPath); errors.Is(err, os.ErrNotExist) {
+				continue
+			} else if err != nil {
+				return err
+			}
+		}
+		if _, err := os.Lstat(oldPath); errors.Is(err, os.ErrNotExist) {
+			if err := os.Rename(target, oldPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		} else if err != nil {
+			return err
+		}
+		if e.op == journalReplace {
+			if err := os.Rename(newPath, target); err != nil {
+				return err
+			}
+		}
+	}
+	return os.RemoveAll(stagingDir)
+}
+
+// rollbackEntries undoes a swapEntries that failed: the new entries that were
+// swapped in are moved back to the staging directory, and the previous
+// entries are restored. The journal is removed last, so that recoverDir
+// completes the write instead if the process is killed in between.
+func rollbackEntries(rootDir, stagingDir string, journal []journalEntry) error {
+	for i := len(journal) - 1; i >= 0; i-- {
+		e := journal[i]
+		target := filepath.Join(rootDir, e.name)
+		newPath := filepath.Join(stagingDir, stagingNew, e.name)
+		oldPath := filepath.Join(stagingDir, stagingOld, e.name)
+		if e.op == journalReplace {
+			if _, err := os.Lstat(newPath); errors.Is(err, os.ErrNotExist) {
+				if err := os.Rename(target, newPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+					return err
+				}
+			}
+		}
+		if err := os.Rename(oldPath, target); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Remove(filepath.Join(stagingDir, stagingJournal))
+}
+
+// recoverDir cleans up after a writeTree of dir that was killed: a staging
+// directory with a journal is swapped in, and other staging directories are
+// removed. It must be called with the lock of dir held.
+func recoverDir(dir string, log *logrus.Logger) error {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !strings.HasPrefix(e.Name(), stagingPrefix) {
+			continue
+		}
+		stagingDir := filepath.Join(dir, e.Name())
+		journal, err := readJournal(stagingDir)
+		if errors.Is(err, os.ErrNotExist) {
+			if err := os.RemoveAll(stagingDir); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
 			return err
 		}
+		log.WithField("dir", dir).Warn("completing an interrupted write of the declarative config directory")
+		if err := swapEntries(dir, stagingDir, journal); err != nil {
+			return fmt.Errorf("complete interrupted write of %q: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+// mkdirLike creates the directory dir, with the permissions of the directory
+// like if it exists.
+func mkdirLike(dir, like string) error {
+	if err := os.Mkdir(dir, 0777); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(like); err == nil && fi.IsDir() {
+		return os.Chmod(dir, fi.Mode().Perm())
 	}
 	return nil
 }
 
+func isHidden(name string) bool {
+	return strings.HasPrefix(name, ".")
+}
+
 func writeFile(cfg declcfg.DeclarativeConfig, filename string, writeFunc WriteFunc) error {
 	buf := &bytes.Buffer{}
 	if err := writeFunc(cfg, buf); err != nil {
-		return fmt.Errorf("write to buffer for %q: %v", filename, err)
+		return fmt.Errorf("write to buffer for %q: %w", filename, err)
 	}
-	if err := os.WriteFile(filename, buf.Bytes(), 0666); err != nil {
-		return fmt.Errorf("write file %q: %v", filename, err)
+	return writeRawFile(filename, buf.Bytes())
+}
+
+// writeRawFile writes data to filename atomically: the file is written to a
+// temporary file in the same directory first, and renamed into place, so
+// that filename never has partial contents.
+func writeRawFile(filename string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".tmp-")
+	if err != nil {
+		return fmt.Errorf("write file %q: %w", filename, err)
+	}
+	defer os.Remove(f.Name())
+	if err := writeAndClose(f, data); err != nil {
+		return fmt.Errorf("write file %q: %w", filename, err)
+	}
+	if err := os.Rename(f.Name(), filename); err != nil {
+		return fmt.Errorf("write file %q: %w", filename, err)
 	}
 	return nil
 }
+
+func writeAndClose(f *os.File, data []byte) error {
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	// Temporary files are only readable by their owner.
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,273 @@
+package action
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/sirupsen/logrus"
+)
+
+// testTree returns a catalog with packages foo and bar.
+func testTree() *declcfg.DeclarativeConfig {
+	fbc := testCatalog()
+	fbc.Packages = append(fbc.Packages, declcfg.Package{Schema: "olm.package", Name: "bar", DefaultChannel: "stable"})
+	fbc.Channels = append(fbc.Channels, declcfg.Channel{Schema: "olm.channel", Package: "bar", Name: "stable", Entries: []declcfg.ChannelEntry{{Name: "bar.v1.0.0"}}})
+	fbc.Bundles = append(fbc.Bundles, declcfg.Bundle{Schema: "olm.bundle", Package: "bar", Name: "bar.v1.0.0", Image: "quay.io/example/bar-bundle:v1.0.0"})
+	return fbc
+}
+
+// listTree returns the paths of the files of dir, relative to dir.
+func listTree(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			files = append(files, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+func writeTestFile(t *testing.T, path, data string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWriteTree(t *testing.T) {
+	type spec struct {
+		name         string
+		removeOthers bool
+		expectFiles  []string
+	}
+	specs := []spec{
+		{
+			// Files of the root that are loaded as part of the catalog,
+			// such as extra.yaml, are written to the package directories.
+			name: "KeepsOtherEntries",
+			expectFiles: []string{
+				".dcm.lock", ".indexignore", "README.md",
+				"bar/catalog.yaml", "foo/catalog.yaml", "old/catalog.yaml",
+			},
+		},
+		{
+			name:         "RemovesOtherEntries",
+			removeOthers: true,
+			expectFiles: []string{
+				".dcm.lock", ".indexignore",
+				"bar/catalog.yaml", "foo/catalog.yaml",
+			},
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for _, f := range []string{".dcm.lock", "README.md", "extra.yaml", "old/catalog.yaml", "foo/catalog.yaml", "foo/stale.yaml"} {
+				writeTestFile(t, filepath.Join(dir, f), "")
+			}
+			writeTestFile(t, filepath.Join(dir, ".indexignore"), "README.md\n")
+			if err := os.Chmod(dir, 0750); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chmod(filepath.Join(dir, "foo"), 0700); err != nil {
+				t.Fatal(err)
+			}
+			before, err := os.Stat(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			written, err := writeTree(*testTree(), dir, declcfg.WriteYAML, s.removeOthers)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			expectWritten := []string{filepath.Join(dir, "foo", "catalog.yaml"), filepath.Join(dir, "bar", "catalog.yaml")}
+			if !reflect.DeepEqual(written, expectWritten) {
+				t.Errorf("expected files written %v, got %v", expectWritten, written)
+			}
+			if files := listTree(t, dir); !reflect.DeepEqual(files, s.expectFiles) {
+				t.Errorf("expected files %v, got %v", s.expectFiles, files)
+			}
+
+			// The directory is written in place.
+			after, err := os.Stat(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !os.SameFile(before, after) || after.Mode() != before.Mode() {
+				t.Errorf("directory was replaced or its mode changed from %v to %v", before.Mode(), after.Mode())
+			}
+			if fi, err := os.Stat(filepath.Join(dir, "foo")); err != nil || fi.Mode().Perm() != 0700 {
+				t.Errorf("expected package directory to keep mode 0700, got %v (%v)", fi.Mode(), err)
+			}
+			fbc, err := declcfg.LoadFS(os.DirFS(dir))
+			if err != nil {
+				t.Fatalf("load written catalog: %v", err)
+			}
+			if len(fbc.Packages) != 2 || len(fbc.Bundles) != 4 {
+				t.Errorf("expected 2 packages and 4 bundles, got %d and %d", len(fbc.Packages), len(fbc.Bundles))
+			}
+		})
+	}
+}
+
+func TestRecoverDir(t *testing.T) {
+	type spec struct {
+		name string
+		// interrupt leaves the staging directory of a write as a process
+		// killed at that point would.
+		interrupt   func(t *testing.T, dir, stagingDir string)
+		expectFiles []string
+		expectNew   bool
+	}
+	rename := func(t *testing.T, from, to string) {
+		t.Helper()
+		if err := os.Rename(from, to); err != nil {
+			t.Fatal(err)
+		}
+	}
+	specs := []spec{
+		{
+			name: "BeforeJournal",
+			interrupt: func(t *testing.T, dir, stagingDir string) {
+				if err := os.Remove(filepath.Join(stagingDir, stagingJournal)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			expectFiles: []string{"foo/catalog.yaml", "foo/stale.yaml"},
+		},
+		{
+			name:        "AfterJournal",
+			interrupt:   func(t *testing.T, dir, stagingDir string) {},
+			expectFiles: []string{"bar/catalog.yaml", "foo/catalog.yaml"},
+			expectNew:   true,
+		},
+		{
+			name: "PackageMovedAside",
+			interrupt: func(t *testing.T, dir, stagingDir string) {
+				rename(t, filepath.Join(dir, "foo"), filepath.Join(stagingDir, stagingOld, "foo"))
+			},
+			expectFiles: []string{"bar/catalog.yaml", "foo/catalog.yaml"},
+			expectNew:   true,
+		},
+		{
+			name: "PackageSwapped",
+			interrupt: func(t *testing.T, dir, stagingDir string) {
+				rename(t, filepath.Join(dir, "foo"), filepath.Join(stagingDir, stagingOld, "foo"))
+				rename(t, filepath.Join(stagingDir, stagingNew, "foo"), filepath.Join(dir, "foo"))
+			},
+			expectFiles: []string{"bar/catalog.yaml", "foo/catalog.yaml"},
+			expectNew:   true,
+		},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTestFile(t, filepath.Join(dir, "foo", "catalog.yaml"), "")
+			writeTestFile(t, filepath.Join(dir, "foo", "stale.yaml"), "")
+
+			// Stage a write as writeTree does, without swapping it in.
+			stagingDir := filepath.Join(dir, stagingPrefix+"test")
+			for _, d := range []string{stagingNew, stagingOld} {
+				if err := os.MkdirAll(filepath.Join(stagingDir, d), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			newTree := filepath.Join(stagingDir, stagingNew)
+			if _, err := writeTree(*testTree(), newTree, declcfg.WriteYAML, false); err != nil {
+				t.Fatal(err)
+			}
+			journal := []journalEntry{{op: journalReplace, name: "foo"}, {op: journalReplace, name: "bar"}}
+			if err := writeJournal(stagingDir, journal); err != nil {
+				t.Fatal(err)
+			}
+			s.interrupt(t, dir, stagingDir)
+
+			log := logrus.New()
+			log.SetOutput(io.Discard)
+			if err := recoverDir(dir, log); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if files := listTree(t, dir); !reflect.DeepEqual(files, s.expectFiles) {
+				t.Errorf("expected files %v, got %v", s.expectFiles, files)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "foo", "catalog.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if isNew := len(data) > 0; isNew != s.expectNew {
+				t.Errorf("expected new package directory %v, got %v", s.expectNew, isNew)
+			}
+		})
+	}
+}
+
+func TestRollbackEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "foo", "catalog.yaml"), "")
+	writeTestFile(t, filepath.Join(dir, "README.md"), "")
+
+	// Stage a write that replaces foo, adds bar and removes README.md, and
+	// fail it after foo is swapped in and README.md moved aside.
+	stagingDir := filepath.Join(dir, stagingPrefix+"test")
+	if err := os.MkdirAll(filepath.Join(stagingDir, stagingOld), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writeTree(*testTree(), filepath.Join(stagingDir, stagingNew), declcfg.WriteYAML, false); err != nil {
+		t.Fatal(err)
+	}
+	journal := []journalEntry{{op: journalReplace, name: "foo"}, {op: journalReplace, name: "bar"}, {op: journalRemove, name: "README.md"}}
+	if err := writeJournal(stagingDir, journal); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range [][2]string{
+		{filepath.Join(dir, "foo"), filepath.Join(stagingDir, stagingOld, "foo")},
+		{filepath.Join(stagingDir, stagingNew, "foo"), filepath.Join(dir, "foo")},
+		{filepath.Join(dir, "README.md"), filepath.Join(stagingDir, stagingOld, "README.md")},
+	} {
+		if err := os.Rename(r[0], r[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := rollbackEntries(dir, stagingDir, journal); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	// Without its journal, the staging directory is removed on recovery.
+	log := logrus.New()
+	log.SetOutput(io.Discard)
+	if err := recoverDir(dir, log); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if files := listTree(t, dir); !reflect.DeepEqual(files, []string{"README.md", "foo/catalog.yaml"}) {
+		t.Errorf("expected previous files, got %v", files)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "foo", "catalog.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 0 {
+		t.Errorf("expected the previous package directory to be restored")
+	}
+}
@@ -0,0 +1,206 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/operator-framework/operator-registry/alpha/model"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	mappingFilename = "mapping.txt"
+	icspFilename    = "imageContentSourcePolicy.yaml"
+	idmsFilename    = "imageDigestMirrorSet.yaml"
+)
+
+// MirrorList generates the files needed to mirror the images referenced by
+// a declarative config directory to another registry: an `oc image mirror`
+// mapping file, an ImageContentSourcePolicy and an ImageDigestMirrorSet.
+type MirrorList struct {
+	FromDir        string
+	TargetRegistry string
+	OutputDir      string
+	// Name is the name of the generated ImageContentSourcePolicy and
+	// ImageDigestMirrorSet objects.
+	Name string
+
+	// Packages and Channels, if set, limit the images to those of the
+	// bundles in the given packages and channels. HeadsOnly limits the
+	// images to those of channel heads.
+	Packages  []string
+	Channels  []string
+	HeadsOnly bool
+
+	Log *logrus.Logger
+}
+
+func (l MirrorList) Run(_ context.Context) (*Result, error) {
+	m, err := loadModel(l.FromDir)
+	if err != nil {
+		return nil, err
+	}
+	images, err := l.collectImages(m)
+	if err != nil {
+		return nil, err
+	}
+
+	mappings := map[string]string{}
+	repoMirrors := map[string]string{}
+	for _, img := range images.List() {
+		src, srcRepo, dstRepo, dst, err := mirrorImage(img, l.TargetRegistry)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.Contains(img, "@") {
+			l.Log.WithField("image", img).Warn("image is not referenced by digest: it will not be matched by the generated mirror policies")
+		}
+		mappings[src] = dst
+		repoMirrors[srcRepo] = dstRepo
+	}
+
+	if err := ensureDir(l.OutputDir); err != nil {
+		return nil, fmt.Errorf("ensure output directory %q: %w", l.OutputDir, err)
+	}
+	l.Log.WithField("dir", l.OutputDir).Infof("writing mirror list for %d images", len(mappings))
+	res := &Result{}
+	mappingFile := filepath.Join(l.OutputDir, mappingFilename)
+	if err := writeMapping(mappingFile, mappings); err != nil {
+		return nil, err
+	}
+	res.FilesWritten = append(res.FilesWritten, mappingFile)
+	for filename, obj := range map[string]interface{}{
+		icspFilename: newICSP(l.Name, repoMirrors),
+		idmsFilename: newIDMS(l.Name, repoMirrors),
+	} {
+		filename = filepath.Join(l.OutputDir, filename)
+		if err := writeYAMLFile(filename, obj); err != nil {
+			return nil, err
+		}
+		res.FilesWritten = append(res.FilesWritten, filename)
+	}
+	sort.Strings(res.FilesWritten)
+	return res, nil
+}
+
+func (l MirrorList) collectImages(m model.Model) (sets.String, error) {
+	packages := sets.NewString(l.Packages...)
+	channels := sets.NewString(l.Channels...)
+	images := sets.NewString()
+	for _, pkg := range m {
+		if packages.Len() > 0 && !packages.Has(pkg.Name) {
+			continue
+		}
+		for _, ch := range pkg.Channels {
+			if channels.Len() > 0 && !channels.Has(ch.Name) {
+				continue
+			}
+			bundles := ch.Bundles
+			if l.HeadsOnly {
+				head, err := ch.Head()
+				if err != nil {
+					return nil, fmt.Errorf("get head of channel %q in package %q: %w", ch.Name, pkg.Name, err)
+				}
+				bundles = map[string]*model.Bundle{head.Name: head}
+			}
+			for _, b := range bundles {
+				if b.Image != "" {
+					images.Insert(b.Image)
+				}
+				for _, ri := range b.RelatedImages {
+					if ri.Image != "" {
+						images.Insert(ri.Image)
+					}
+				}
+			}
+		}
+	}
+	return images, nil
+}
+
+// mirrorImage returns the full reference and source repository of img, along
+// with the repository and reference of its mirror in targetRegistry. Short
+// references such as foo/bar are expanded to the names the cluster pulls,
+// such as docker.io/foo/bar, so that the mirror policies match them. The
+// mirror keeps the repository path of the source image, without its registry
+// host.
+func mirrorImage(img, targetRegistry string) (src, srcRepo, dstRepo, dst string, err error) {
+	named, err := docker.ParseNormalizedNamed(img)
+	if err != nil {
+		return "", "", "", "", fmt.Errorf("parse image reference %q: %w", img, err)
+	}
+	dstRepo = strings.TrimSuffix(targetRegistry, "/") + "/" + docker.Path(named)
+	dst = dstRepo
+	switch r := named.(type) {
+	case docker.Digested:
+		dst += "@" + r.Digest().String()
+	case docker.Tagged:
+		dst += ":" + r.Tag()
+	}
+	return named.String(), named.Name(), dstRepo, dst, nil
+}
+
+func writeMapping(filename string, mappings map[string]string) error {
+	srcs := make([]string, 0, len(mappings))
+	for src := range mappings {
+		srcs = append(srcs, src)
+	}
+	sort.Strings(srcs)
+	var sb strings.Builder
+	for _, src := range srcs {
+		fmt.Fprintf(&sb, "%s=%s\n", src, mappings[src])
+	}
+	return writeRawFile(filename, []byte(sb.String()))
+}
+
+type repositoryMirror struct {
+	Source  string   `json:"source"`
+	Mirrors []string `json:"mirrors"`
+}
+
+func sortedRepositoryMirrors(repoMirrors map[string]string) []repositoryMirror {
+	var out []repositoryMirror
+	for src, mirror := range repoMirrors {
+		out = append(out, repositoryMirror{Source: src, Mirrors: []string{mirror}})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Source < out[j].Source
+	})
+	return out
+}
+
+func newICSP(name string, repoMirrors map[string]string) interface{} {
+	return map[string]interface{}{
+		"apiVersion": "operator.openshift.io/v1alpha1",
+		"kind":       "ImageContentSourcePolicy",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"repositoryDigestMirrors": sortedRepositoryMirrors(repoMirrors),
+		},
+	}
+}
+
+func newIDMS(name string, repoMirrors map[string]string) interface{} {
+	return map[string]interface{}{
+		"apiVersion": "config.openshift.io/v1",
+		"kind":       "ImageDigestMirrorSet",
+		"metadata":   map[string]interface{}{"name": name},
+		"spec": map[string]interface{}{
+			"imageDigestMirrors": sortedRepositoryMirrors(repoMirrors),
+		},
+	}
+}
+
+func writeYAMLFile(filename string, obj interface{}) error {
+	data, err := yaml.Marshal(obj)
+	if err != nil {
+		return fmt.Errorf("marshal %q: %w", filename, err)
+	}
+	return writeRawFile(filename, data)
+}
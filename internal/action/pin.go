@@ -0,0 +1,115 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/containerd/containerd/remotes"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/sirupsen/logrus"
+)
+
+// Pin resolves the bundle images and related images of every bundle in a
+// declarative config directory to digest references.
+type Pin struct {
+	FromDir string
+
+	RegistryOptions RegistryOptions
+	LockTimeout     time.Duration
+	Log             *logrus.Logger
+}
+
+func (p Pin) Run(ctx context.Context) (*Result, error) {
+	resolver, err := newResolver(p.RegistryOptions)
+	if err != nil {
+		return nil, fmt.Errorf("create registry resolver: %w", err)
+	}
+	dr := newDigestResolver(resolver, p.RegistryOptions, p.Log)
+	return mutateFBC(p.FromDir, p.LockTimeout, p.Log, func(fbc *declcfg.DeclarativeConfig) error {
+		for i := range fbc.Bundles {
+			if err := dr.pinBundle(ctx, &fbc.Bundles[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// digestResolver rewrites image references to digest references. Resolved
+// digests are remembered, so that each reference is resolved only once.
+type digestResolver struct {
+	resolver remotes.Resolver
+	opts     RegistryOptions
+	log      *logrus.Logger
+	pinned   map[string]string
+}
+
+func newDigestResolver(resolver remotes.Resolver, opts RegistryOptions, log *logrus.Logger) *digestResolver {
+	return &digestResolver{
+		resolver: resolver,
+		opts:     opts,
+		log:      log,
+		pinned:   map[string]string{},
+	}
+}
+
+// pinBundle rewrites the bundle image and related images of b to digest
+// references.
+func (r *digestResolver) pinBundle(ctx context.Context, b *declcfg.Bundle) error {
+	if b.Image != "" {
+		pinned, err := r.pin(ctx, b.Image)
+		if err != nil {
+			return fmt.Errorf("pin image of bundle %q: %w", b.Name, err)
+		}
+		b.Image = pinned
+	}
+	for i, ri := range b.RelatedImages {
+		if ri.Image == "" {
+			continue
+		}
+		pinned, err := r.pin(ctx, ri.Image)
+		if err != nil {
+			return fmt.Errorf("pin related image %q of bundle %q: %w", ri.Name, b.Name, err)
+		}
+		b.RelatedImages[i].Image = pinned
+	}
+	return nil
+}
+
+// pin returns the digest reference for img. References that already contain
+// a digest are returned unchanged.
+func (r *digestResolver) pin(ctx context.Context, img string) (string, error) {
+	if pinned, ok := r.pinned[img]; ok {
+		return pinned, nil
+	}
+	// Short references, such as foo/bar:v1, are resolved on docker.io, as
+	// by the container tools.
+	named, err := docker.ParseNormalizedNamed(img)
+	if err != nil {
+		return "", fmt.Errorf("parse image reference %q: %w", img, err)
+	}
+	if _, ok := named.(docker.Digested); ok {
+		return img, nil
+	}
+
+	var desc ocispec.Descriptor
+	err = retry(ctx, r.opts.PullRetries, r.opts.PullTimeout, r.log.WithField("image", img), func(ctx context.Context) error {
+		var err error
+		_, desc, err = r.resolver.Resolve(ctx, docker.TagNameOnly(named).String())
+		return err
+	})
+	if err != nil {
+		return "", classify(ErrPull, fmt.Errorf("resolve digest of %q: %w", img, err))
+	}
+	canonical, err := docker.WithDigest(docker.TrimNamed(named), desc.Digest)
+	if err != nil {
+		return "", err
+	}
+	pinned := canonical.String()
+	r.log.WithFields(logrus.Fields{"image": img, "pinned": pinned}).Info("pinned image to digest")
+	r.pinned[img] = pinned
+	return pinned, nil
+}
@@ -0,0 +1,297 @@
+package action
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/containerd/containerd/content"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/images"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/platforms"
+	"github.com/containerd/containerd/remotes"
+	"github.com/containerd/containerd/remotes/docker"
+	dockerconfig "github.com/docker/cli/cli/config"
+	"github.com/docker/cli/cli/config/configfile"
+	"github.com/docker/cli/cli/config/credentials"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/operator-framework/operator-registry/pkg/containertools"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/operator-framework/operator-registry/pkg/image/containerdregistry"
+	"github.com/operator-framework/operator-registry/pkg/image/execregistry"
+	"github.com/sirupsen/logrus"
+)
+
+// ContainerTool selects the backend used to pull and unpack images.
+type ContainerTool string
+
+const (
+	// ContainerToolNone pulls images with the built-in containerd-based
+	// registry client, like ContainerToolContainerd.
+	ContainerToolNone       ContainerTool = "none"
+	ContainerToolContainerd ContainerTool = "containerd"
+	ContainerToolPodman     ContainerTool = "podman"
+	ContainerToolDocker     ContainerTool = "docker"
+)
+
+// RegistryOptions configures how images are pulled from remote registries.
+type RegistryOptions struct {
+	// ContainerTool is the backend used to pull images. The podman and
+	// docker backends reuse the local container storage of the respective
+	// tool, and use its registry configuration.
+	ContainerTool ContainerTool
+
+	// AuthFile is the path of a docker or podman style auth file. If empty,
+	// the default docker configuration is used.
+	AuthFile string
+	// CAFile is the path of a PEM bundle of certificate authorities trusted
+	// in addition to the system pool.
+	CAFile string
+
+	SkipTLSVerify bool
+	UseHTTP       bool
+
+	// CacheDir, if set, is the directory of a persistent image cache shared
+	// across invocations. CacheMaxSize limits the size of the cache in
+	// bytes, evicting the least recently used images. Zero means unlimited.
+	CacheDir     string
+	CacheMaxSize int64
+
+	// PullTimeout bounds each attempt to pull an image. Zero means no limit.
+	PullTimeout time.Duration
+	// PullRetries is the number of times a failed pull is retried, with
+	// exponential backoff.
+	PullRetries int
+}
+
+func newRegistry(opts RegistryOptions, log *logrus.Logger) (image.Registry, error) {
+	resolver, err := newResolver(opts)
+	if err != nil {
+		return nil, fmt.Errorf("create registry resolver: %w", err)
+	}
+
+	var r image.Registry
+	switch opts.ContainerTool {
+	case "", ContainerToolNone, ContainerToolContainerd:
+		r, err = newContainerdRegistry(resolver, log)
+	case ContainerToolPodman, ContainerToolDocker:
+		r, err = newExecRegistry(opts, log)
+	default:
+		err = fmt.Errorf("unknown container tool %q", opts.ContainerTool)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.CacheDir != "" {
+		cache, err := openImageCache(opts.CacheDir, opts.CacheMaxSize)
+		if err != nil {
+			_ = r.Destroy()
+			return nil, err
+		}
+		r = newCachingRegistry(r, cache, resolver, log)
+	}
+	return &retryingRegistry{Registry: r, timeout: opts.PullTimeout, retries: opts.PullRetries, log: log}, nil
+}
+
+func newContainerdRegistry(resolver remotes.Resolver, log *logrus.Logger) (image.Registry, error) {
+	regCacheDir, err := os.MkdirTemp("", "dcm-cache-")
+	if err != nil {
+		return nil, err
+	}
+	reg, err := containerdregistry.NewRegistry(
+		containerdregistry.WithCacheDir(regCacheDir),
+		containerdregistry.WithLog(logrus.NewEntry(log)),
+	)
+	if err != nil {
+		os.RemoveAll(regCacheDir)
+		return nil, err
+	}
+	return &containerdRegistry{Registry: reg, resolver: resolver}, nil
+}
+
+func newExecRegistry(opts RegistryOptions, log *logrus.Logger) (image.Registry, error) {
+	if opts.AuthFile != "" || opts.CAFile != "" {
+		log.Warnf("ignoring auth and CA files: container tool %q uses its own registry configuration", opts.ContainerTool)
+	}
+	tool := containertools.NewContainerTool(string(opts.ContainerTool), containertools.NoneTool)
+	return execregistry.NewRegistry(tool, logrus.NewEntry(log), containertools.SkipTLS(opts.SkipTLSVerify || opts.UseHTTP))
+}
+
+func destroyRegistry(reg image.Registry, log *logrus.Logger) {
+	if err := reg.Destroy(); err != nil {
+		log.Warnf("destroy temporary image registry: %v", err)
+	}
+}
+
+// containerdRegistry is a containerd-based image registry that resolves and
+// fetches images using a resolver configured from RegistryOptions. The
+// upstream registry only supports a single insecure mode that both skips TLS
+// verification and forces plain HTTP for every host.
+type containerdRegistry struct {
+	*containerdregistry.Registry
+	resolver remotes.Resolver
+}
+
+func (r *containerdRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	if _, namespaced := namespaces.Namespace(ctx); !namespaced {
+		ctx = namespaces.WithNamespace(ctx, namespaces.Default)
+	}
+
+	name, root, err := r.resolver.Resolve(ctx, ref.String())
+	if err != nil {
+		return fmt.Errorf("error resolving name %s: %w", ref.String(), err)
+	}
+	if root.MediaType == images.MediaTypeDockerSchema1Manifest {
+		return fmt.Errorf("specified image is a docker schema v1 manifest, which is not supported")
+	}
+	fetcher, err := r.resolver.Fetcher(ctx, name)
+	if err != nil {
+		return err
+	}
+	handler := images.Handlers(
+		remotes.FetchHandler(r.Content(), fetcher),
+		images.ChildrenHandler(r.Content()),
+	)
+	if err := images.Dispatch(ctx, handler, nil, root); err != nil {
+		return err
+	}
+
+	img := images.Image{
+		Name:   ref.String(),
+		Target: root,
+	}
+	if _, err = r.Images().Create(ctx, img); errdefs.IsAlreadyExists(err) {
+		_, err = r.Images().Update(ctx, img)
+	}
+	return err
+}
+
+// Labels returns the labels of a pulled image. Unlike the upstream registry,
+// it does not log the whole image configuration as a warning.
+func (r *containerdRegistry) Labels(ctx context.Context, ref image.Reference) (map[string]string, error) {
+	if _, namespaced := namespaces.Namespace(ctx); !namespaced {
+		ctx = namespaces.WithNamespace(ctx, namespaces.Default)
+	}
+
+	img, err := r.Images().Get(ctx, ref.String())
+	if err != nil {
+		return nil, err
+	}
+	platform := platforms.Ordered(platforms.DefaultSpec(), ocispec.Platform{OS: "linux", Architecture: "amd64"})
+	manifest, err := images.Manifest(ctx, r.Content(), img.Target, platform)
+	if err != nil {
+		return nil, err
+	}
+	data, err := content.ReadBlob(ctx, r.Content(), manifest.Config)
+	if err != nil {
+		return nil, err
+	}
+	var config ocispec.Image
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("parse configuration of image %q: %w", ref, err)
+	}
+	return config.Config.Labels, nil
+}
+
+func newResolver(opts RegistryOptions) (remotes.Resolver, error) {
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		return nil, fmt.Errorf("load system certificate pool: %w", err)
+	}
+	if opts.CAFile != "" {
+		pem, err := os.ReadFile(opts.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA file: %w", err)
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %q", opts.CAFile)
+		}
+	}
+	cfg, err := loadAuthConfig(opts.AuthFile)
+	if err != nil {
+		return nil, fmt.Errorf("load auth file: %w", err)
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 5 * time.Second,
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: opts.SkipTLSVerify,
+			RootCAs:            roots,
+		},
+	}
+	client := &http.Client{Transport: transport}
+	headers := http.Header{}
+	headers.Set("User-Agent", "dcm")
+
+	regopts := []docker.RegistryOpt{
+		docker.WithAuthorizer(docker.NewDockerAuthorizer(
+			docker.WithAuthClient(client),
+			docker.WithAuthHeader(headers),
+			docker.WithAuthCreds(credentialFunc(cfg)),
+		)),
+		docker.WithClient(client),
+	}
+	if opts.UseHTTP {
+		regopts = append(regopts, docker.WithPlainHTTP(docker.MatchAllHosts))
+	}
+	return docker.NewResolver(docker.ResolverOptions{
+		Hosts:   docker.ConfigureDefaultRegistries(regopts...),
+		Headers: headers,
+	}), nil
+}
+
+func loadAuthConfig(authFile string) (*configfile.ConfigFile, error) {
+	var (
+		cfg *configfile.ConfigFile
+		err error
+	)
+	if authFile == "" {
+		cfg, err = dockerconfig.Load(dockerconfig.Dir())
+	} else {
+		var f *os.File
+		if f, err = os.Open(authFile); err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		cfg, err = dockerconfig.LoadFromReader(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.ContainsAuth() {
+		cfg.CredentialsStore = credentials.DetectDefaultStore(cfg.CredentialsStore)
+	}
+	return cfg, nil
+}
+
+func credentialFunc(cfg *configfile.ConfigFile) func(string) (string, string, error) {
+	return func(hostname string) (string, string, error) {
+		if hostname == "registry-1.docker.io" || hostname == "docker.io" {
+			hostname = "https://index.docker.io/v1/"
+		}
+		auth, err := cfg.GetAuthConfig(hostname)
+		if err != nil {
+			return "", "", err
+		}
+		if auth.IdentityToken != "" {
+			return "", auth.IdentityToken, nil
+		}
+		return auth.Username, auth.Password, nil
+	}
+}
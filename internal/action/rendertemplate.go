@@ -0,0 +1,164 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/yaml"
+)
+
+// Template is a short description of a catalog, from which the complete
+// file-based catalog is rendered.
+type Template struct {
+	Packages []TemplatePackage `json:"packages"`
+}
+
+// TemplatePackage lists the bundle images of a package. Channels and
+// DefaultChannel, if set, override the channels and default channel declared
+// in the metadata of the bundles.
+type TemplatePackage struct {
+	Name           string           `json:"name"`
+	DefaultChannel string           `json:"defaultChannel,omitempty"`
+	Channels       []string         `json:"channels,omitempty"`
+	Bundles        []TemplateBundle `json:"bundles"`
+}
+
+// TemplateBundle is a bundle image of a package. Channels, if set, override
+// the channels of the package for this bundle.
+type TemplateBundle struct {
+	Image    string   `json:"image"`
+	Channels []string `json:"channels,omitempty"`
+}
+
+// LoadTemplate reads a template from a YAML or JSON file.
+func LoadTemplate(filename string) (*Template, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("read template: %w", err)
+	}
+	var t Template
+	if err := yaml.UnmarshalStrict(data, &t); err != nil {
+		return nil, fmt.Errorf("parse template %q: %w", filename, err)
+	}
+	return &t, nil
+}
+
+// RenderTemplate renders a complete file-based catalog from a template. The
+// channel graph of each package is built from the bundles' replaces, skips
+// and skipRange, in the same way as the add command.
+type RenderTemplate struct {
+	Template  Template
+	OutputDir string
+	// Overwrite allows rendering into an output directory that holds a
+	// file-based catalog, which is replaced. Other non-empty directories are
+	// never overwritten.
+	Overwrite bool
+	// LockTimeout is how long to wait for the catalog lock of the output
+	// directory when it is overwritten.
+	LockTimeout time.Duration
+	// Validators and SkipValidation select the validators run on the
+	// bundles, as in Add.
+	Validators     []string
+	SkipValidation bool
+
+	RegistryOptions RegistryOptions
+	Log             *logrus.Logger
+}
+
+func (r RenderTemplate) Run(ctx context.Context) (*Result, error) {
+	// The template is checked as a whole before the output directory is
+	// locked and any image is pulled.
+	seen := sets.NewString()
+	for _, p := range r.Template.Packages {
+		if p.Name == "" {
+			return nil, fmt.Errorf("template contains a package without a name")
+		}
+		if seen.Has(p.Name) {
+			return nil, fmt.Errorf("package %q is listed more than once", p.Name)
+		}
+		seen.Insert(p.Name)
+		if len(p.Bundles) == 0 {
+			return nil, fmt.Errorf("package %q lists no bundles", p.Name)
+		}
+	}
+
+	entries, err := os.ReadDir(r.OutputDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("read output directory %q: %w", r.OutputDir, err)
+	}
+	if len(entries) > 0 {
+		if !r.Overwrite {
+			return nil, classify(ErrOutputNotEmpty, fmt.Errorf("output directory %q is not empty", r.OutputDir))
+		}
+		// Only a catalog is overwritten, so that a mistyped output directory
+		// does not lose unrelated files.
+		if old, err := loadFBC(r.OutputDir); err != nil || len(old.Packages) == 0 {
+			return nil, classify(ErrOutputNotEmpty, fmt.Errorf("output directory %q is not empty and is not a file-based catalog: refusing to overwrite it", r.OutputDir))
+		}
+		// The catalog is replaced as a whole, but concurrent commands that
+		// modify it must not interleave with the write.
+		unlock, err := lockCatalog(r.OutputDir, r.LockTimeout, r.Log)
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+	}
+
+	reg, err := newRegistry(r.RegistryOptions, r.Log)
+	if err != nil {
+		return nil, fmt.Errorf("create temporary image registry: %w", err)
+	}
+	defer destroyRegistry(reg, r.Log)
+
+	fbc := &declcfg.DeclarativeConfig{}
+	for _, p := range r.Template.Packages {
+		r.Log.WithField("package", p.Name).Info("rendering package")
+		add := Add{
+			Channels:        p.Channels,
+			DefaultChannel:  p.DefaultChannel,
+			channelsByImage: map[string][]string{},
+			Validators:      r.Validators,
+			SkipValidation:  r.SkipValidation,
+			RegistryOptions: r.RegistryOptions,
+			Log:             r.Log,
+		}
+		for _, b := range p.Bundles {
+			add.BundleImages = append(add.BundleImages, b.Image)
+			if len(b.Channels) > 0 {
+				add.channelsByImage[b.Image] = b.Channels
+			}
+		}
+		// Each package is rendered on its own, so that a bundle of another
+		// package listed under it cannot change that package.
+		pfbc := &declcfg.DeclarativeConfig{}
+		if err := add.apply(ctx, reg, pfbc); err != nil {
+			return nil, fmt.Errorf("render package %q: %w", p.Name, err)
+		}
+		for _, b := range pfbc.Bundles {
+			if b.Package != p.Name {
+				return nil, fmt.Errorf("bundle %q belongs to package %q, not %q", b.Image, b.Package, p.Name)
+			}
+		}
+		fbc.Packages = append(fbc.Packages, pfbc.Packages...)
+		fbc.Channels = append(fbc.Channels, pfbc.Channels...)
+		fbc.Bundles = append(fbc.Bundles, pfbc.Bundles...)
+		fbc.Others = append(fbc.Others, pfbc.Others...)
+	}
+
+	if _, err := declcfg.ConvertToModel(*fbc); err != nil {
+		return nil, classify(ErrInvalidResult, fmt.Errorf("rendered file-based catalog is invalid: %w", err))
+	}
+	res := diffCatalogs(catalogSnapshot{}, snapshotCatalog(fbc))
+	r.Log.WithField("dir", r.OutputDir).Info("writing rendered file-based catalog")
+	// The rendered catalog replaces the previous one. Hidden files, such as
+	// .indexignore, are kept.
+	if res.FilesWritten, err = writeTree(*fbc, r.OutputDir, declcfg.WriteYAML, true); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,99 @@
+package action
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+)
+
+// Result describes what an action did. Bundles are identified by
+// "<package>/<bundle>", channels by "<package>/<channel>", and packages by
+// name.
+type Result struct {
+	AddedBundles    []string `json:"addedBundles,omitempty"`
+	RemovedBundles  []string `json:"removedBundles,omitempty"`
+	UpdatedBundles  []string `json:"updatedBundles,omitempty"`
+	ChangedChannels []string `json:"changedChannels,omitempty"`
+	// ChangedPackages lists the packages whose package blob was added,
+	// removed or changed, such as by a new default channel.
+	ChangedPackages []string `json:"changedPackages,omitempty"`
+	// RemovedImages lists the digests of the images removed from the image
+	// cache.
+	RemovedImages []string `json:"removedImages,omitempty"`
+	FilesWritten  []string `json:"filesWritten,omitempty"`
+	Warnings      []string `json:"warnings,omitempty"`
+}
+
+// catalogSnapshot records the serialized packages, bundles and channels of a
+// catalog, so that the changes made to it can be computed after it is
+// mutated in place.
+type catalogSnapshot struct {
+	packages map[string]string
+	bundles  map[string]string
+	channels map[string]string
+}
+
+func snapshotCatalog(fbc *declcfg.DeclarativeConfig) catalogSnapshot {
+	s := catalogSnapshot{
+		packages: map[string]string{},
+		bundles:  map[string]string{},
+		channels: map[string]string{},
+	}
+	for _, p := range fbc.Packages {
+		data, _ := json.Marshal(p)
+		s.packages[p.Name] = string(data)
+	}
+	for _, b := range fbc.Bundles {
+		data, _ := json.Marshal(b)
+		s.bundles[b.Package+"/"+b.Name] = string(data)
+	}
+	for _, ch := range fbc.Channels {
+		data, _ := json.Marshal(ch.Entries)
+		s.channels[ch.Package+"/"+ch.Name] = string(data)
+	}
+	return s
+}
+
+// diffCatalogs returns the packages, bundles and channels that differ
+// between before and after.
+func diffCatalogs(before, after catalogSnapshot) *Result {
+	res := &Result{
+		ChangedPackages: changedKeys(before.packages, after.packages),
+		ChangedChannels: changedKeys(before.channels, after.channels),
+	}
+	for name, b := range after.bundles {
+		if old, ok := before.bundles[name]; !ok {
+			res.AddedBundles = append(res.AddedBundles, name)
+		} else if old != b {
+			res.UpdatedBundles = append(res.UpdatedBundles, name)
+		}
+	}
+	for name := range before.bundles {
+		if _, ok := after.bundles[name]; !ok {
+			res.RemovedBundles = append(res.RemovedBundles, name)
+		}
+	}
+	sort.Strings(res.AddedBundles)
+	sort.Strings(res.RemovedBundles)
+	sort.Strings(res.UpdatedBundles)
+	return res
+}
+
+// changedKeys returns the sorted keys that were added, removed or changed
+// between before and after.
+func changedKeys(before, after map[string]string) []string {
+	var changed []string
+	for k, v := range after {
+		if old, ok := before[k]; !ok || old != v {
+			changed = append(changed, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
@@ -0,0 +1,58 @@
+package action
+
+import (
+	"context"
+	"time"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/sirupsen/logrus"
+)
+
+// initialBackoff is the delay before the first retry of a failed operation.
+// It doubles with every retry.
+const initialBackoff = time.Second
+
+// retry calls fn until it succeeds, at most retries+1 times, waiting with
+// exponential backoff between attempts. Each attempt is bounded by timeout,
+// unless it is zero. Errors for missing images are not retried, and neither
+// are attempts after ctx is done.
+func retry(ctx context.Context, retries int, timeout time.Duration, log *logrus.Entry, fn func(context.Context) error) error {
+	backoff := initialBackoff
+	for attempt := 1; ; attempt++ {
+		err := attemptWithTimeout(ctx, timeout, fn)
+		if err == nil || attempt > retries || ctx.Err() != nil || errdefs.IsNotFound(err) {
+			return err
+		}
+		log.Warnf("attempt %d failed, retrying in %s: %v", attempt, backoff, err)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func attemptWithTimeout(ctx context.Context, timeout time.Duration, fn func(context.Context) error) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return fn(ctx)
+}
+
+// retryingRegistry retries failed pulls of the registry it wraps.
+type retryingRegistry struct {
+	image.Registry
+	timeout time.Duration
+	retries int
+	log     *logrus.Logger
+}
+
+func (r *retryingRegistry) Pull(ctx context.Context, ref image.Reference) error {
+	return retry(ctx, r.retries, r.timeout, r.log.WithField("image", ref.String()), func(ctx context.Context) error {
+		return r.Registry.Pull(ctx, ref)
+	})
+}
@@ -0,0 +1,206 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/containerd/containerd/reference/docker"
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/sirupsen/logrus"
+)
+
+// ImageMapping maps image references starting with From to references
+// starting with To. From matches whole path components only: it must be
+// followed by "/", ":", "@" or the end of the reference.
+type ImageMapping struct {
+	From string
+	To   string
+}
+
+// RewriteImages rewrites the image references of a declarative config
+// directory, replacing registry and repository prefixes.
+type RewriteImages struct {
+	FromDir  string
+	Mappings []ImageMapping
+	// RewriteObjects enables rewriting of image references inside the
+	// olm.bundle.object payloads of bundles, including their CSV.
+	RewriteObjects bool
+
+	LockTimeout time.Duration
+	Log         *logrus.Logger
+}
+
+func (r RewriteImages) Run(_ context.Context) (*Result, error) {
+	return mutateFBC(r.FromDir, r.LockTimeout, r.Log, r.apply)
+}
+
+func (r RewriteImages) apply(fbc *declcfg.DeclarativeConfig) error {
+	rw := newImageRewriter(r.Mappings)
+	for i := range fbc.Bundles {
+		b := &fbc.Bundles[i]
+		img, err := rw.rewrite(b.Image)
+		if err != nil {
+			return fmt.Errorf("rewrite image of bundle %q: %w", b.Name, err)
+		}
+		b.Image = img
+		for j := range b.RelatedImages {
+			img, err := rw.rewrite(b.RelatedImages[j].Image)
+			if err != nil {
+				return fmt.Errorf("rewrite related image of bundle %q: %w", b.Name, err)
+			}
+			b.RelatedImages[j].Image = img
+		}
+		if r.RewriteObjects {
+			if err := rw.rewriteObjects(b); err != nil {
+				return fmt.Errorf("rewrite objects of bundle %q: %w", b.Name, err)
+			}
+		}
+	}
+	r.Log.Infof("rewrote %d image references", rw.count)
+	return nil
+}
+
+type imageRewriter struct {
+	mappings []ImageMapping
+	count    int
+}
+
+func newImageRewriter(mappings []ImageMapping) *imageRewriter {
+	sorted := make([]ImageMapping, len(mappings))
+	copy(sorted, mappings)
+	// Longest prefixes first, so that the most specific mapping wins.
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].From) > len(sorted[j].From)
+	})
+	return &imageRewriter{mappings: sorted}
+}
+
+// rewrite returns img with the longest matching prefix replaced. It returns
+// an error if the rewritten reference is not valid.
+func (r *imageRewriter) rewrite(img string) (string, error) {
+	for _, m := range r.mappings {
+		if matchImagePrefix(img, m.From) {
+			rewritten := m.To + strings.TrimPrefix(img, m.From)
+			if _, err := docker.Parse(rewritten); err != nil {
+				return "", fmt.Errorf("rewrite %q to %q with mapping %q=%q: %w", img, rewritten, m.From, m.To, err)
+			}
+			r.count++
+			return rewritten, nil
+		}
+	}
+	return img, nil
+}
+
+// matchImagePrefix reports whether img starts with prefix, and prefix ends at
+// a boundary of img: a "/", ":" or "@" separator or the end of img. This
+// keeps quay.io/staging from matching quay.io/staging-tools/foo.
+func matchImagePrefix(img, prefix string) bool {
+	if !strings.HasPrefix(img, prefix) {
+		return false
+	}
+	if len(img) == len(prefix) || strings.HasSuffix(prefix, "/") {
+		return true
+	}
+	switch img[len(prefix)] {
+	case '/', ':', '@':
+		return true
+	}
+	return false
+}
+
+// rewriteObjects rewrites every image reference in the bundle objects of b
+// that starts with a mapped prefix. Changed objects are stored inline in the
+// bundle's olm.bundle.object properties.
+func (r *imageRewriter) rewriteObjects(b *declcfg.Bundle) error {
+	if len(b.Objects) == 0 {
+		return nil
+	}
+	changed := false
+	objects := make([]string, 0, len(b.Objects))
+	for _, obj := range b.Objects {
+		var v interface{}
+		if err := json.Unmarshal([]byte(obj), &v); err != nil {
+			return fmt.Errorf("parse bundle object: %w", err)
+		}
+		before := r.count
+		v, err := r.rewriteValue(v)
+		if err != nil {
+			return err
+		}
+		if r.count == before {
+			objects = append(objects, obj)
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Errorf("marshal bundle object: %w", err)
+		}
+		objects = append(objects, string(data))
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	tmpProperties := b.Properties[:0]
+	for _, p := range b.Properties {
+		if p.Type != property.TypeBundleObject {
+			tmpProperties = append(tmpProperties, p)
+		}
+	}
+	b.Properties = tmpProperties
+	for _, obj := range objects {
+		b.Properties = append(b.Properties, property.MustBuildBundleObjectData([]byte(obj)))
+	}
+	b.Objects = objects
+	b.CsvJSON = findCSV(objects)
+	return nil
+}
+
+// rewriteValue rewrites the strings of v that are image references. Other
+// strings, such as descriptions that mention an image, are left as they are.
+func (r *imageRewriter) rewriteValue(v interface{}) (interface{}, error) {
+	var err error
+	switch t := v.(type) {
+	case string:
+		if _, perr := docker.Parse(t); perr != nil {
+			return t, nil
+		}
+		return r.rewrite(t)
+	case []interface{}:
+		for i := range t {
+			if t[i], err = r.rewriteValue(t[i]); err != nil {
+				return nil, err
+			}
+		}
+	case map[string]interface{}:
+		for k := range t {
+			if t[k], err = r.rewriteValue(t[k]); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return v, nil
+}
+
+// findCSV returns the ClusterServiceVersion among objects, or an empty string
+// if there is none.
+func findCSV(objects []string) string {
+	for _, obj := range objects {
+		var meta struct {
+			Kind string `json:"kind"`
+		}
+		if err := json.Unmarshal([]byte(obj), &meta); err != nil {
+			continue
+		}
+		if meta.Kind == "ClusterServiceVersion" {
+			return obj
+		}
+	}
+	return ""
+}
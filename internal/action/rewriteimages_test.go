@@ -0,0 +1,69 @@
+package action
+
+import (
+	"testing"
+)
+
+func TestMatchImagePrefix(t *testing.T) {
+	type spec struct {
+		name   string
+		img    string
+		prefix string
+		expect bool
+	}
+	specs := []spec{
+		{name: "Repository", img: "quay.io/staging/foo:v1", prefix: "quay.io/staging", expect: true},
+		{name: "Tag", img: "quay.io/staging:v1", prefix: "quay.io/staging", expect: true},
+		{name: "Digest", img: "quay.io/staging@sha256:abc", prefix: "quay.io/staging", expect: true},
+		{name: "Exact", img: "quay.io/staging", prefix: "quay.io/staging", expect: true},
+		{name: "TrailingSlash", img: "quay.io/staging/foo:v1", prefix: "quay.io/", expect: true},
+		{name: "PartialComponent", img: "quay.io/staging-tools/foo:v1", prefix: "quay.io/staging", expect: false},
+		{name: "PartialRegistry", img: "quay.io.example.com/foo:v1", prefix: "quay.io", expect: false},
+		{name: "NoMatch", img: "registry.example.com/foo:v1", prefix: "quay.io", expect: false},
+		{name: "LongerPrefix", img: "quay.io/foo", prefix: "quay.io/foo/bar", expect: false},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			if got := matchImagePrefix(s.img, s.prefix); got != s.expect {
+				t.Errorf("matchImagePrefix(%q, %q): expected %v, got %v", s.img, s.prefix, s.expect, got)
+			}
+		})
+	}
+}
+
+func TestImageRewriterRewrite(t *testing.T) {
+	mappings := []ImageMapping{
+		{From: "quay.io/staging", To: "registry.example.com/prod"},
+		{From: "quay.io/staging/special", To: "registry.example.com/special"},
+		{From: "quay.io/broken", To: "registry.example.com/UPPER"},
+	}
+	type spec struct {
+		name      string
+		img       string
+		expect    string
+		expectErr bool
+	}
+	specs := []spec{
+		{name: "Rewritten", img: "quay.io/staging/foo:v1", expect: "registry.example.com/prod/foo:v1"},
+		{name: "LongestPrefixWins", img: "quay.io/staging/special/foo@sha256:0000000000000000000000000000000000000000000000000000000000000000", expect: "registry.example.com/special/foo@sha256:0000000000000000000000000000000000000000000000000000000000000000"},
+		{name: "PartialComponentUnchanged", img: "quay.io/staging-tools/foo:v1", expect: "quay.io/staging-tools/foo:v1"},
+		{name: "InvalidResult", img: "quay.io/broken/foo:v1", expectErr: true},
+	}
+	for _, s := range specs {
+		t.Run(s.name, func(t *testing.T) {
+			got, err := newImageRewriter(mappings).rewrite(s.img)
+			if s.expectErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != s.expect {
+				t.Errorf("expected %q, got %q", s.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/operator-framework/operator-registry/pkg/api"
+	health "github.com/operator-framework/operator-registry/pkg/api/grpc_health_v1"
+	"github.com/operator-framework/operator-registry/pkg/lib/graceful"
+	"github.com/operator-framework/operator-registry/pkg/registry"
+	"github.com/operator-framework/operator-registry/pkg/server"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/reflection"
+)
+
+// Serve exposes a declarative config directory over the operator-registry
+// gRPC API. The directory is polled for changes, and reloaded when it
+// changes. If the changed catalog is invalid, the previous one keeps being
+// served. The catalog is read with the catalog lock held, as a reader, so
+// that commands writing to it are never observed halfway.
+type Serve struct {
+	FromDir string
+	Port    int
+	// ReloadInterval is the interval at which the directory is checked for
+	// changes. Zero disables reloading.
+	ReloadInterval time.Duration
+
+	Log *logrus.Logger
+}
+
+func (s Serve) Run(ctx context.Context) error {
+	store := &reloadingQuerier{}
+	fp, err := s.load(store, lockWaitForever)
+	if err != nil {
+		return err
+	}
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", s.Port))
+	if err != nil {
+		return fmt.Errorf("listen on port %d: %w", s.Port, err)
+	}
+
+	grpcServer := grpc.NewServer()
+	api.RegisterRegistryServer(grpcServer, server.NewRegistryServer(store))
+	health.RegisterHealthServer(grpcServer, server.NewHealthServer())
+	reflection.Register(grpcServer)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if s.ReloadInterval > 0 {
+		go s.watch(ctx, store, fp)
+	}
+
+	s.Log.WithFields(logrus.Fields{"dir": s.FromDir, "port": s.Port}).Info("serving catalog")
+	return graceful.Shutdown(s.Log, func() error {
+		return grpcServer.Serve(lis)
+	}, func() {
+		cancel()
+		grpcServer.GracefulStop()
+	})
+}
+
+// reloadLockTimeout bounds the wait for the catalog lock when reloading. A
+// catalog that is locked for longer is reloaded at a later check.
+const reloadLockTimeout = 2 * time.Second
+
+// load loads the catalog into store, and returns the fingerprint of the
+// directory it was loaded from. It holds a shared catalog lock while loading,
+// so that it never reads a catalog in the middle of a write, waiting at most
+// lockTimeout for it. An error of class ErrLocked is returned on timeout.
+func (s Serve) load(store *reloadingQuerier, lockTimeout time.Duration) (string, error) {
+	var onWait func()
+	if lockTimeout == lockWaitForever {
+		onWait = func() {
+			s.Log.WithField("dir", s.FromDir).Info("waiting for another process to release the catalog lock")
+		}
+	}
+	unlock, err := lockFile(filepath.Join(s.FromDir, catalogLockFile), false, lockTimeout, onWait)
+	if errors.Is(err, ErrLocked) {
+		return "", err
+	}
+	if err != nil {
+		// The directory may be read-only, e.g. when mounted into a
+		// container, in which case nothing else writes to it either.
+		s.Log.WithField("dir", s.FromDir).Debugf("loading catalog without lock: %v", err)
+		unlock = func() {}
+	}
+	defer unlock()
+
+	fp, err := dirFingerprint(s.FromDir)
+	if err != nil {
+		return "", err
+	}
+	m, err := loadModel(s.FromDir)
+	if err != nil {
+		return "", err
+	}
+	store.set(registry.NewQuerier(m))
+	return fp, nil
+}
+
+func (s Serve) watch(ctx context.Context, store *reloadingQuerier, fp string) {
+	ticker := time.NewTicker(s.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		cur, err := dirFingerprint(s.FromDir)
+		if err != nil {
+			s.Log.WithField("dir", s.FromDir).Warnf("check for changes: %v", err)
+			continue
+		}
+		if cur == fp {
+			continue
+		}
+		loaded, err := s.load(store, reloadLockTimeout)
+		if errors.Is(err, ErrLocked) {
+			s.Log.WithField("dir", s.FromDir).Debug("catalog is locked by another process, reloading at the next check")
+			continue
+		}
+		if err != nil {
+			// Remember the new fingerprint even if loading fails, so that
+			// an invalid catalog is reported only once.
+			fp = cur
+			s.Log.WithField("dir", s.FromDir).Warnf("reload failed, still serving the previous catalog: %v", err)
+			continue
+		}
+		fp = loaded
+		s.Log.WithField("dir", s.FromDir).Info("reloaded catalog")
+	}
+}
+
+// dirFingerprint summarizes the names, sizes and modification times of the
+// files in dir, except its lock file.
+func dirFingerprint(dir string) (string, error) {
+	var fp string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path == filepath.Join(dir, catalogLockFile) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fp += fmt.Sprintf("%s:%d:%d\n", path, info.Size(), info.ModTime().UnixNano())
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("walk %q: %w", dir, err)
+	}
+	return fp, nil
+}
+
+// reloadingQuerier is a registry.GRPCQuery whose underlying querier can be
+// replaced while it is being served.
+type reloadingQuerier struct {
+	mu sync.RWMutex
+	q  registry.GRPCQuery
+}
+
+var _ registry.GRPCQuery = &reloadingQuerier{}
+
+func (r *reloadingQuerier) set(q registry.GRPCQuery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.q = q
+}
+
+func (r *reloadingQuerier) get() registry.GRPCQuery {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.q
+}
+
+func (r *reloadingQuerier) ListPackages(ctx context.Context) ([]string, error) {
+	return r.get().ListPackages(ctx)
+}
+
+func (r *reloadingQuerier) SendBundles(ctx context.Context, stream registry.BundleSender) error {
+	return r.get().SendBundles(ctx, stream)
+}
+
+func (r *reloadingQuerier) ListBundles(ctx context.Context) ([]*api.Bundle, error) {
+	return r.get().ListBundles(ctx)
+}
+
+func (r *reloadingQuerier) GetPackage(ctx context.Context, name string) (*registry.PackageManifest, error) {
+	return r.get().GetPackage(ctx, name)
+}
+
+func (r *reloadingQuerier) GetBundle(ctx context.Context, pkgName, channelName, csvName string) (*api.Bundle, error) {
+	return r.get().GetBundle(ctx, pkgName, channelName, csvName)
+}
+
+func (r *reloadingQuerier) GetBundleForChannel(ctx context.Context, pkgName string, channelName string) (*api.Bundle, error) {
+	return r.get().GetBundleForChannel(ctx, pkgName, channelName)
+}
+
+func (r *reloadingQuerier) GetChannelEntriesThatReplace(ctx context.Context, name string) ([]*registry.ChannelEntry, error) {
+	return r.get().GetChannelEntriesThatReplace(ctx, name)
+}
+
+func (r *reloadingQuerier) GetBundleThatReplaces(ctx context.Context, name, pkgName, channelName string) (*api.Bundle, error) {
+	return r.get().GetBundleThatReplaces(ctx, name, pkgName, channelName)
+}
+
+func (r *reloadingQuerier) GetChannelEntriesThatProvide(ctx context.Context, group, version, kind string) ([]*registry.ChannelEntry, error) {
+	return r.get().GetChannelEntriesThatProvide(ctx, group, version, kind)
+}
+
+func (r *reloadingQuerier) GetLatestChannelEntriesThatProvide(ctx context.Context, group, version, kind string) ([]*registry.ChannelEntry, error) {
+	return r.get().GetLatestChannelEntriesThatProvide(ctx, group, version, kind)
+}
+
+func (r *reloadingQuerier) GetBundleThatProvides(ctx context.Context, group, version, kind string) (*api.Bundle, error) {
+	return r.get().GetBundleThatProvides(ctx, group, version, kind)
+}
@@ -0,0 +1,115 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/operator-framework/operator-registry/alpha/declcfg"
+	"github.com/operator-framework/operator-registry/alpha/property"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/util/sets"
+)
+
+// UpdateBundle replaces the payload of bundles already present in a
+// declarative config directory, such as the respin of a bundle with the same
+// CSV, with the contents of their bundle images. Unlike Add with
+// OverwriteLatest, the channel entries are kept exactly as they are, and so
+// are the properties of the bundles that their images do not declare.
+type UpdateBundle struct {
+	FromDir      string
+	BundleImages []string
+	// PinDigests rewrites the bundle images and related images of the
+	// updated bundles to digest references.
+	PinDigests bool
+
+	RegistryOptions RegistryOptions
+	LockTimeout     time.Duration
+	Log             *logrus.Logger
+}
+
+func (u UpdateBundle) Run(ctx context.Context) (*Result, error) {
+	reg, err := newRegistry(u.RegistryOptions, u.Log)
+	if err != nil {
+		return nil, fmt.Errorf("create temporary image registry: %w", err)
+	}
+	defer destroyRegistry(reg, u.Log)
+
+	return mutateFBC(u.FromDir, u.LockTimeout, u.Log, func(fbc *declcfg.DeclarativeConfig) error {
+		return u.apply(ctx, reg, fbc)
+	})
+}
+
+func (u UpdateBundle) apply(ctx context.Context, reg image.Registry, fbc *declcfg.DeclarativeConfig) error {
+	updated := sets.NewString()
+	for _, img := range u.BundleImages {
+		u.Log.WithField("image", img).Info("pulling bundle")
+		rBundle, err := getRegistryBundle(ctx, reg, img, nil)
+		if err != nil {
+			return fmt.Errorf("get registry bundle for image %q: %w", img, err)
+		}
+		b, err := newBundle(rBundle)
+		if err != nil {
+			return err
+		}
+
+		i := bundleIndex(fbc.Bundles, b.Package, b.Name)
+		if i < 0 {
+			return classify(ErrBundleNotFound, fmt.Errorf("bundle %q not found in package %q", b.Name, b.Package))
+		}
+		u.Log.WithFields(logrus.Fields{"package": b.Package, "bundle": b.Name, "image": img}).Info("updating bundle")
+		u.warnChangedEdges(fbc.Channels, b)
+
+		nb := b.ToFBC()
+		// Only channel heads keep their objects, see Add.
+		if !hasBundleObjects(fbc.Bundles[i]) {
+			nb.Properties = withoutBundleObjects(nb.Properties)
+			nb.Objects = nil
+		}
+		nb.Properties = u.keepCatalogProperties(fbc.Bundles[i], nb.Properties)
+		fbc.Bundles[i] = nb
+		updated.Insert(b.Name)
+	}
+	if u.PinDigests {
+		return pinBundles(ctx, u.RegistryOptions, u.Log, fbc, updated)
+	}
+	return nil
+}
+
+// warnChangedEdges warns about the channel entries of b whose upgrade edges
+// differ from those declared in its CSV, as they are kept unchanged.
+func (u UpdateBundle) warnChangedEdges(channels []declcfg.Channel, b *bundle) {
+	for _, ch := range channels {
+		if ch.Package != b.Package {
+			continue
+		}
+		for _, e := range ch.Entries {
+			if e.Name != b.Name {
+				continue
+			}
+			if e.Replaces != b.Replaces || e.SkipRange != b.SkipRange || !sets.NewString(e.Skips...).Equal(sets.NewString(b.Skips...)) {
+				u.Log.WithFields(logrus.Fields{"package": b.Package, "bundle": b.Name, "channel": ch.Name}).Warnf(
+					"the upgrade edges of bundle %q in channel %q differ from its CSV, and are kept unchanged", b.Name, ch.Name)
+			}
+		}
+	}
+}
+
+// keepCatalogProperties returns props along with the properties of the
+// catalog's bundle old whose type the new payload does not declare, such as
+// an olm.deprecated property added to the catalog by hand.
+func (u UpdateBundle) keepCatalogProperties(old declcfg.Bundle, props []property.Property) []property.Property {
+	declared := sets.NewString(property.TypeBundleObject)
+	for _, p := range props {
+		declared.Insert(p.Type)
+	}
+	for _, p := range old.Properties {
+		if declared.Has(p.Type) {
+			continue
+		}
+		u.Log.WithFields(logrus.Fields{"package": old.Package, "bundle": old.Name, "property": p.Type}).Info("keeping property of the catalog that the bundle image does not declare")
+		props = append(props, p)
+	}
+	return props
+}
@@ -3,40 +3,240 @@ package action
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
-	"github.com/operator-framework/operator-registry/pkg/image"
-	"github.com/operator-framework/operator-registry/pkg/image/containerdregistry"
+	"github.com/operator-framework/operator-registry/alpha/model"
+	"github.com/operator-framework/operator-registry/alpha/property"
 	libsemver "github.com/operator-framework/operator-registry/pkg/lib/semver"
 	"github.com/sirupsen/logrus"
 	"k8s.io/apimachinery/pkg/util/sets"
 )
 
-func nullLogger() *logrus.Entry {
-	logger := logrus.New()
-	logger.SetOutput(ioutil.Discard)
-	return logrus.NewEntry(logger)
+// indexIgnoreFile is the file whose patterns select the files of a
+// declarative config directory that are not part of the catalog.
+const indexIgnoreFile = ".indexignore"
+
+// catalogFS returns the file system of the declarative config directory dir,
+// without its hidden entries, such as the lock file, the staging directories
+// of writeTree and VCS metadata. .indexignore files are kept.
+func catalogFS(dir string) fs.FS {
+	return hiddenFS{os.DirFS(dir)}
+}
+
+// hiddenFS hides the entries of a file system whose name starts with a dot,
+// except .indexignore files.
+type hiddenFS struct {
+	fsys fs.FS
+}
+
+func (h hiddenFS) Open(name string) (fs.File, error) {
+	if h.hidden(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return h.fsys.Open(name)
+}
+
+func (h hiddenFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if h.hidden(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	entries, err := fs.ReadDir(h.fsys, name)
+	visible := entries[:0]
+	for _, e := range entries {
+		if !isHidden(e.Name()) || (e.Name() == indexIgnoreFile && !e.IsDir()) {
+			visible = append(visible, e)
+		}
+	}
+	return visible, err
 }
 
-func newRegistry() (image.Registry, error) {
-	regCacheDir, err := os.MkdirTemp("", "dcm-cache-")
+func (h hiddenFS) hidden(name string) bool {
+	if name == "." {
+		return false
+	}
+	parts := strings.Split(name, "/")
+	for i, part := range parts {
+		if isHidden(part) && !(i == len(parts)-1 && part == indexIgnoreFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// loadFBC loads the file-based catalog at dir, as seen through catalogFS.
+func loadFBC(dir string) (*declcfg.DeclarativeConfig, error) {
+	return declcfg.LoadFS(catalogFS(dir))
+}
+
+func loadModel(dir string) (model.Model, error) {
+	fbc, err := loadFBC(dir)
+	if err != nil {
+		return nil, classify(ErrInvalidInput, fmt.Errorf("load file-based catalog at %q: %w", dir, err))
+	}
+	m, err := declcfg.ConvertToModel(*fbc)
+	if err != nil {
+		return nil, classify(ErrInvalidInput, fmt.Errorf("file-based catalog at %q is invalid: %w", dir, err))
+	}
+	return m, nil
+}
+
+// validateFBC checks that fbc converts to a valid model.
+func validateFBC(fbc declcfg.DeclarativeConfig) error {
+	_, err := declcfg.ConvertToModel(fbc)
+	return err
+}
+
+// orphanedBlobs returns the schema and package, as "<schema>/<package>", of
+// the blobs of other schemas that are scoped to a package that is not in the
+// catalog, which the model conversion does not check.
+func orphanedBlobs(fbc declcfg.DeclarativeConfig) sets.String {
+	packages := sets.NewString()
+	for _, p := range fbc.Packages {
+		packages.Insert(p.Name)
+	}
+	orphaned := sets.NewString()
+	for _, o := range fbc.Others {
+		if o.Package != "" && !packages.Has(o.Package) {
+			orphaned.Insert(o.Schema + "/" + o.Package)
+		}
+	}
+	return orphaned
+}
+
+// mutateFBC loads and validates the file-based catalog at dir, applies
+// mutate to it, and writes it back only if the result is valid. The catalog
+// lock of dir is held throughout, waiting at most lockTimeout for it. As
+// processes that do not take the lock may still modify the directory, the
+// catalog is not written if its contents changed since it was loaded.
+func mutateFBC(dir string, lockTimeout time.Duration, log *logrus.Logger, mutate func(*declcfg.DeclarativeConfig) error) (*Result, error) {
+	unlock, err := lockCatalog(dir, lockTimeout, log)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	hash, err := catalogHash(dir)
+	if err != nil {
+		return nil, classify(ErrInvalidInput, err)
+	}
+	fbc, err := loadFBC(dir)
+	if err != nil {
+		return nil, classify(ErrInvalidInput, fmt.Errorf("load file-based catalog at %q: %w", dir, err))
+	}
+	if err := validateFBC(*fbc); err != nil {
+		return nil, classify(ErrInvalidInput, fmt.Errorf("input file-based catalog at %q is invalid: %w", dir, err))
+	}
+	// Blobs that already refer to a missing package are carried over, but a
+	// command must not leave behind the blobs of a package it removed.
+	orphaned := orphanedBlobs(*fbc)
+	for _, o := range orphaned.List() {
+		log.WithField("blob", o).Warn("blob refers to a package that is not in the catalog")
+	}
+	before := snapshotCatalog(fbc)
+	if err := mutate(fbc); err != nil {
+		return nil, err
+	}
+	if err := validateFBC(*fbc); err != nil {
+		return nil, classify(ErrInvalidResult, fmt.Errorf("updated file-based catalog is invalid: %w", err))
+	}
+	if added := orphanedBlobs(*fbc).Difference(orphaned); added.Len() > 0 {
+		return nil, classify(ErrInvalidResult, fmt.Errorf("updated file-based catalog is invalid: blobs %s refer to packages that are no longer in the catalog", strings.Join(added.List(), ", ")))
+	}
+	res := diffCatalogs(before, snapshotCatalog(fbc))
+
+	current, err := catalogHash(dir)
 	if err != nil {
 		return nil, err
 	}
-	return containerdregistry.NewRegistry(
-		containerdregistry.WithCacheDir(regCacheDir),
-		containerdregistry.WithLog(nullLogger()),
-	)
+	if current != hash {
+		return nil, classify(ErrCatalogChanged, fmt.Errorf("declarative config directory %q was modified by another process", dir))
+	}
+	log.WithField("dir", dir).Info("writing updated file-based catalog")
+	if res.FilesWritten, err = writeToFS(*fbc, dir, declcfg.WriteYAML); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// findBundle returns the bundle whose name or image matches nameOrImage.
+func findBundle(bundles []declcfg.Bundle, nameOrImage string) (*declcfg.Bundle, error) {
+	var found *declcfg.Bundle
+	for i, b := range bundles {
+		if b.Name != nameOrImage && b.Image != nameOrImage {
+			continue
+		}
+		if found != nil {
+			return nil, fmt.Errorf("bundle %q is ambiguous: found in packages %q and %q", nameOrImage, found.Package, b.Package)
+		}
+		found = &bundles[i]
+	}
+	if found == nil {
+		return nil, classify(ErrBundleNotFound, fmt.Errorf("bundle %q not found", nameOrImage))
+	}
+	return found, nil
 }
 
-func destroyRegistry(reg image.Registry, log *logrus.Logger) {
-	if err := reg.Destroy(); err != nil {
-		log.Warnf("destroy temporary image registry: %v", err)
+func findChannel(channels []declcfg.Channel, packageName, channelName string) *declcfg.Channel {
+	for i, ch := range channels {
+		if ch.Package == packageName && ch.Name == channelName {
+			return &channels[i]
+		}
 	}
+	return nil
+}
+
+func channelHasEntry(ch declcfg.Channel, name string) bool {
+	for _, e := range ch.Entries {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func entryIndex(ch declcfg.Channel, name string) int {
+	for i, e := range ch.Entries {
+		if e.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// findEntry returns the first entry named name in the channels of a package.
+func findEntry(channels []declcfg.Channel, packageName, name string) (declcfg.ChannelEntry, bool) {
+	for _, ch := range channels {
+		if ch.Package != packageName {
+			continue
+		}
+		if i := entryIndex(ch, name); i >= 0 {
+			return ch.Entries[i], true
+		}
+	}
+	return declcfg.ChannelEntry{}, false
+}
+
+// entryHeads returns the names of the entries of ch that no other entry
+// replaces or skips.
+func entryHeads(ch declcfg.Channel) sets.String {
+	replaced := sets.NewString()
+	for _, e := range ch.Entries {
+		replaced.Insert(e.Replaces)
+		replaced.Insert(e.Skips...)
+	}
+	heads := sets.NewString()
+	for _, e := range ch.Entries {
+		if !replaced.Has(e.Name) {
+			heads.Insert(e.Name)
+		}
+	}
+	return heads
 }
 
 func ensureDir(dir string) error {
@@ -53,40 +253,55 @@ func ensureDir(dir string) error {
 	return nil
 }
 
-func updateFBCPackage(fbc *declcfg.DeclarativeConfig, pkgOut declcfg.DeclarativeConfig) {
-	if len(pkgOut.Packages) != 1 {
-		panic("function precondition not met: expected exactly one output package")
+// setBundle replaces the bundle of fbc with the same package and name as b,
+// or appends b if there is none.
+func setBundle(fbc *declcfg.DeclarativeConfig, b declcfg.Bundle) {
+	if i := bundleIndex(fbc.Bundles, b.Package, b.Name); i >= 0 {
+		fbc.Bundles[i] = b
+		return
 	}
+	fbc.Bundles = append(fbc.Bundles, b)
+}
 
-	packageName := pkgOut.Packages[0].Name
-
-	tmpPkgs := fbc.Packages[:0]
-	for _, p := range fbc.Packages {
-		if p.Name != packageName {
-			tmpPkgs = append(tmpPkgs, p)
+func bundleIndex(bundles []declcfg.Bundle, pkg, name string) int {
+	for i, b := range bundles {
+		if b.Package == pkg && b.Name == name {
+			return i
 		}
 	}
-	fbc.Packages = tmpPkgs
+	return -1
+}
 
-	tmpChannels := fbc.Channels[:0]
-	for _, c := range fbc.Channels {
-		if c.Package != packageName {
-			tmpChannels = append(tmpChannels, c)
+func hasBundleObjects(b declcfg.Bundle) bool {
+	for _, p := range b.Properties {
+		if p.Type == property.TypeBundleObject {
+			return true
 		}
 	}
-	fbc.Channels = tmpChannels
+	return false
+}
 
-	tmpBundles := fbc.Bundles[:0]
-	for _, b := range fbc.Bundles {
-		if b.Package != packageName {
-			tmpBundles = append(tmpBundles, b)
+func withoutBundleObjects(props []property.Property) []property.Property {
+	var out []property.Property
+	for _, p := range props {
+		if p.Type != property.TypeBundleObject {
+			out = append(out, p)
 		}
 	}
-	fbc.Bundles = tmpBundles
+	return out
+}
 
-	fbc.Packages = append(fbc.Packages, pkgOut.Packages...)
-	fbc.Channels = append(fbc.Channels, pkgOut.Channels...)
-	fbc.Bundles = append(fbc.Bundles, pkgOut.Bundles...)
+// latestVersion returns the highest version among the bundles of pkg.
+func latestVersion(pkg *model.Package) semver.Version {
+	var latest semver.Version
+	for _, ch := range pkg.Channels {
+		for _, b := range ch.Bundles {
+			if b.Version.GT(latest) {
+				latest = b.Version
+			}
+		}
+	}
+	return latest
 }
 
 func getSubsChains(bundles []*bundle) ([]string, map[string]string, error) {
@@ -112,7 +327,7 @@ func getSubsChains(bundles []*bundle) ([]string, map[string]string, error) {
 			for _, b := range subs[i+1:] {
 				v, err := libsemver.BuildIdCompare(versions[a], versions[b])
 				if err != nil {
-					return nil, nil, fmt.Errorf("build id comparison between %q and %q failed: %v", versions[a], versions[b], err)
+					return nil, nil, fmt.Errorf("build id comparison between %q and %q failed: %w", versions[a], versions[b], err)
 				}
 				comps[key{a, b}] = v
 			}
@@ -136,7 +351,7 @@ func getSubsChains(bundles []*bundle) ([]string, map[string]string, error) {
 	return originals.List(), chain, nil
 }
 
-func addSubsFor(cfg *declcfg.DeclarativeConfig, orig string, sub string) {
+func addSubsFor(cfg *declcfg.DeclarativeConfig, packageName, orig, sub string) {
 	// Rules:
 	//  - sub entry skips orig entry
 	//  - orig entry's outgoing edges MOVED to sub entry
@@ -145,6 +360,9 @@ func addSubsFor(cfg *declcfg.DeclarativeConfig, orig string, sub string) {
 	//  - orig entry's incoming replaces edges CHANGED to skips
 
 	for i, ch := range cfg.Channels {
+		if ch.Package != packageName {
+			continue
+		}
 		// sub entry skips orig entry
 		subEntry := declcfg.ChannelEntry{Name: sub, Skips: []string{orig}}
 		for j, e := range ch.Entries {
@@ -0,0 +1,231 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/blang/semver"
+	"github.com/operator-framework/api/pkg/manifests"
+	"github.com/operator-framework/api/pkg/operators/v1alpha1"
+	apivalidation "github.com/operator-framework/api/pkg/validation"
+	apierrors "github.com/operator-framework/api/pkg/validation/errors"
+	interfaces "github.com/operator-framework/api/pkg/validation/interfaces"
+	"github.com/operator-framework/operator-registry/pkg/image"
+	libbundle "github.com/operator-framework/operator-registry/pkg/lib/bundle"
+	"github.com/operator-framework/operator-registry/pkg/lib/validation"
+	"github.com/operator-framework/operator-registry/pkg/registry"
+	"github.com/sirupsen/logrus"
+)
+
+// Validators of bundle images, run by Add on each added bundle before the
+// catalog is modified.
+const (
+	// ValidatorFormat checks the layout of the bundle image and its
+	// metadata/annotations.yaml, and that the package and channels it
+	// declares match the labels of the image.
+	ValidatorFormat = "format"
+	// ValidatorCSV checks the ClusterServiceVersion of the bundle.
+	ValidatorCSV = "csv"
+	// ValidatorCRD checks the CustomResourceDefinitions of the bundle.
+	ValidatorCRD = "crd"
+	// ValidatorBundle checks that the CRDs owned by the CSV are in the
+	// bundle, and that the bundle contains no other CRDs.
+	ValidatorBundle = "bundle"
+	// ValidatorVersions checks that the olm.skipRange annotation and the
+	// minKubeVersion of the CSV are valid semver.
+	ValidatorVersions = "versions"
+	// ValidatorOperatorHub checks the requirements of OperatorHub.io. It does
+	// not run by default.
+	ValidatorOperatorHub = "operatorhub"
+	// ValidatorBundleObjects checks other objects of the bundle, such as
+	// PodDisruptionBudgets. It does not run by default.
+	ValidatorBundleObjects = "bundle-objects"
+)
+
+// DefaultValidators are the validators run when none are selected.
+var DefaultValidators = []string{ValidatorFormat, ValidatorCSV, ValidatorCRD, ValidatorBundle, ValidatorVersions}
+
+// bundleValidators maps the name of each validator to its implementation,
+// which returns the problems found in a bundle.
+var bundleValidators = map[string]func(v bundleValidation) []error{
+	ValidatorFormat:        validateFormat,
+	ValidatorCSV:           validateCSV,
+	ValidatorCRD:           validateCRDs,
+	ValidatorBundle:        validateBundleCRDs,
+	ValidatorVersions:      validateVersions,
+	ValidatorOperatorHub:   validateOperatorHub,
+	ValidatorBundleObjects: validateBundleObjects,
+}
+
+// checkValidators returns an error if any of names is not a known validator.
+func checkValidators(names []string) error {
+	for _, name := range names {
+		if _, ok := bundleValidators[name]; !ok {
+			known := make([]string, 0, len(bundleValidators))
+			for k := range bundleValidators {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("unknown bundle validator %q: expected one of %v", name, known)
+		}
+	}
+	return nil
+}
+
+// bundleValidation is the input of the validators: a bundle image, the
+// directory it is unpacked in, and the bundle parsed from it.
+type bundleValidation struct {
+	ctx    context.Context
+	reg    image.Registry
+	image  string
+	dir    string
+	bundle *registry.Bundle
+	log    *logrus.Logger
+}
+
+// bundleValidationError lists the problems that the validators found in a
+// bundle image.
+type bundleValidationError struct {
+	image    string
+	problems []error
+}
+
+func (e *bundleValidationError) Error() string {
+	return fmt.Sprintf("bundle %q failed validation with %d problems", e.image, len(e.problems))
+}
+
+// validateBundle runs the named validators on a bundle, and returns a
+// *bundleValidationError if they found problems.
+func validateBundle(v bundleValidation, names []string) error {
+	var problems []error
+	for _, name := range names {
+		v.log.WithFields(logrus.Fields{"image": v.image, "validator": name}).Debug("validating bundle")
+		for _, p := range bundleValidators[name](v) {
+			problems = append(problems, fmt.Errorf("%s: %w", name, p))
+		}
+	}
+	if len(problems) > 0 {
+		return &bundleValidationError{image: v.image, problems: problems}
+	}
+	return nil
+}
+
+func validateFormat(v bundleValidation) []error {
+	validator := libbundle.NewImageValidator(v.reg, logrus.NewEntry(v.log))
+	if err := validator.ValidateBundleFormat(v.dir); err != nil {
+		if verr, ok := err.(libbundle.ValidationError); ok {
+			return verr.Errors
+		}
+		return []error{err}
+	}
+
+	labels, err := v.reg.Labels(v.ctx, image.SimpleReference(v.image))
+	if err != nil {
+		return []error{fmt.Errorf("get labels of image: %w", err)}
+	}
+	var problems []error
+	if pkg, ok := labels[libbundle.PackageLabel]; ok && pkg != v.bundle.Package {
+		problems = append(problems, fmt.Errorf("package %q of metadata/annotations.yaml does not match %q of label %q", v.bundle.Package, pkg, libbundle.PackageLabel))
+	}
+	if v.bundle.Annotations != nil {
+		if channels, ok := labels[libbundle.ChannelsLabel]; ok && channels != v.bundle.Annotations.Channels {
+			problems = append(problems, fmt.Errorf("channels %q of metadata/annotations.yaml do not match %q of label %q", v.bundle.Annotations.Channels, channels, libbundle.ChannelsLabel))
+		}
+	}
+	return problems
+}
+
+func validateCSV(v bundleValidation) []error {
+	csv, err := apiCSV(v.bundle)
+	if err != nil {
+		return []error{err}
+	}
+	return resultErrors(v, apivalidation.ClusterServiceVersionValidator, csv)
+}
+
+func validateCRDs(v bundleValidation) []error {
+	crds, err := v.bundle.CustomResourceDefinitions()
+	if err != nil {
+		return []error{fmt.Errorf("get CRDs: %w", err)}
+	}
+	objs := make([]interface{}, 0, len(crds))
+	for _, crd := range crds {
+		objs = append(objs, crd)
+	}
+	return resultErrors(v, apivalidation.CustomResourceDefinitionValidator, objs...)
+}
+
+func validateBundleCRDs(v bundleValidation) []error {
+	return resultErrors(v, validation.RegistryBundleValidator, v.bundle)
+}
+
+func validateVersions(v bundleValidation) []error {
+	csv, err := apiCSV(v.bundle)
+	if err != nil {
+		return []error{err}
+	}
+	var problems []error
+	if skipRange := csv.GetAnnotations()[v1alpha1.SkipRangeAnnotationKey]; skipRange != "" {
+		if _, err := semver.ParseRange(skipRange); err != nil {
+			problems = append(problems, fmt.Errorf("invalid %s %q: %w", v1alpha1.SkipRangeAnnotationKey, skipRange, err))
+		}
+	}
+	if mkv := csv.Spec.MinKubeVersion; mkv != "" {
+		if _, err := semver.ParseTolerant(mkv); err != nil {
+			problems = append(problems, fmt.Errorf("invalid minKubeVersion %q: %w", mkv, err))
+		}
+	}
+	return problems
+}
+
+func validateOperatorHub(v bundleValidation) []error {
+	csv, err := apiCSV(v.bundle)
+	if err != nil {
+		return []error{err}
+	}
+	return resultErrors(v, apivalidation.OperatorHubValidator, &manifests.Bundle{Name: csv.GetName(), CSV: csv})
+}
+
+func validateBundleObjects(v bundleValidation) []error {
+	objs := make([]interface{}, 0, len(v.bundle.Objects))
+	for _, obj := range v.bundle.Objects {
+		objs = append(objs, obj)
+	}
+	return resultErrors(v, apivalidation.ObjectValidator, objs...)
+}
+
+// resultErrors runs validator on objs and returns its errors. Warnings are
+// logged.
+func resultErrors(v bundleValidation, validator interfaces.Validator, objs ...interface{}) []error {
+	var problems []error
+	for _, res := range validator.Validate(objs...) {
+		for _, e := range res.Errors {
+			switch e.Level {
+			case apierrors.LevelError:
+				problems = append(problems, e)
+			case apierrors.LevelWarn:
+				v.log.WithFields(logrus.Fields{"image": v.image, "bundle": v.bundle.Name}).Warn(e.Error())
+			}
+		}
+	}
+	return problems
+}
+
+// apiCSV converts the CSV of b to the type of operator-framework/api.
+func apiCSV(b *registry.Bundle) (*v1alpha1.ClusterServiceVersion, error) {
+	rcsv, err := b.ClusterServiceVersion()
+	if err != nil {
+		return nil, fmt.Errorf("get CSV: %w", err)
+	}
+	data, err := json.Marshal(rcsv)
+	if err != nil {
+		return nil, fmt.Errorf("marshal CSV: %w", err)
+	}
+	var csv v1alpha1.ClusterServiceVersion
+	if err := json.Unmarshal(data, &csv); err != nil {
+		return nil, fmt.Errorf("parse CSV: %w", err)
+	}
+	return &csv, nil
+}
@@ -1,13 +1,12 @@
 package cmd
 
 import (
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/release-engineering/dcm/internal/action"
 )
 
-func newAddCmd() *cobra.Command {
+func newAddCmd(opts *globalOptions) *cobra.Command {
 	var (
 		add action.Add
 	)
@@ -17,14 +16,29 @@ func newAddCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			add.FromDir = args[0]
+			add.LockTimeout = opts.LockTimeout
 			add.BundleImages = args[1:]
-			add.Log = logrus.New()
+			add.RegistryOptions = opts.Registry
+			add.Log = opts.log
 
-			if err := add.Run(cmd.Context()); err != nil {
-				add.Log.Fatal(err)
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := add.Run(ctx)
+			if err != nil {
+				fatal(add.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(add.Log, err)
 			}
 		},
 	}
 	cmd.Flags().BoolVar(&add.OverwriteLatest, "overwrite-latest", false, "Allow bundles that are channel heads to be overwritten")
+	cmd.Flags().BoolVar(&add.OverwritePartialHeads, "overwrite-partial-heads", false, "With --overwrite-latest, also overwrite bundles that are the head of only some of their channels, keeping their entries in the other channels")
+	cmd.Flags().BoolVar(&add.PinDigests, "pin-digests", false, "Resolve the bundle images and related images of the added bundles to digests")
+	cmd.Flags().StringSliceVar(&add.Channels, "channels", nil, "Channels to add the bundles to, overriding the channels in the bundle metadata")
+	cmd.Flags().StringVar(&add.DefaultChannel, "default-channel", "", "Default channel of the package, overriding the default channel in the bundle metadata")
+	cmd.Flags().StringSliceVar(&add.Validators, "validators", action.DefaultValidators, "Validators run on the added bundles: any of format, csv, crd, bundle, versions, operatorhub and bundle-objects")
+	cmd.Flags().BoolVar(&add.SkipValidation, "skip-validation", false, "Do not validate the added bundles")
+	cmd.Flags().StringVar((*string)(&add.PackageMetadata), "package-metadata", string(action.PackageMetadataFromHead), "Source of the description and icon of existing packages: from-head (the head of the default channel, when it is added) or keep (the existing ones)")
 	return cmd
 }
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newApplyCmd(opts *globalOptions) *cobra.Command {
+	var (
+		apply    action.Apply
+		planFile string
+	)
+	cmd := &cobra.Command{
+		Use:   "apply <dcDir>",
+		Short: "Apply a plan of operations to a declarative config directory in a single transaction",
+		Long: `Apply a plan of operations to a declarative config directory in a single transaction.
+
+The steps of the plan are applied in order to the catalog in memory. The
+catalog is validated and written once all steps succeed; if any step fails,
+nothing is written.
+
+Each step of the plan contains exactly one of the following operations:
+
+  add:               {bundles, channels, defaultChannel, packageMetadata, overwriteLatest, overwritePartialHeads, pinDigests, validators, skipValidation}
+  deprecate:         {bundles}
+  remove:            {bundles}
+  promote:           {bundle, fromChannel, toChannel}
+  setDefaultChannel: {package, channel}
+  renameChannel:     {package, channel, newName}
+  removeChannel:     {package, channel}`,
+		Example: `  cat > plan.yaml <<EOF
+  steps:
+  - add:
+      bundles:
+      - quay.io/example/foo-bundle:v0.3.0
+  - deprecate:
+      bundles:
+      - quay.io/example/foo-bundle:v0.1.0
+  - promote:
+      bundle: foo.v0.3.0
+      toChannel: stable
+  EOF
+  dcm apply ./catalog -f plan.yaml`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			apply.FromDir = args[0]
+			apply.LockTimeout = opts.LockTimeout
+			apply.RegistryOptions = opts.Registry
+			apply.Log = opts.log
+
+			plan, err := action.LoadPlan(planFile)
+			if err != nil {
+				fatal(apply.Log, err)
+			}
+			apply.Plan = *plan
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := apply.Run(ctx)
+			if err != nil {
+				fatal(apply.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(apply.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&planFile, "file", "f", "", "Path of the plan file")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newBuildCmd(opts *globalOptions) *cobra.Command {
+	var (
+		build action.BuildOCILayout
+	)
+	cmd := &cobra.Command{
+		Use:   "build <dcDir>",
+		Short: "Build an index image from a declarative config directory into an OCI image layout",
+		Long: `Build an index image from a declarative config directory into an OCI image layout.
+
+The image consists of a single layer containing the declarative config root
+at /configs, and has no base image. No container daemon or registry is needed
+to build it. The layout can be pushed with tools such as skopeo, or used as
+the source of a multi-stage build that adds opm.`,
+		Example: `  dcm build ./catalog --oci-layout ./index-layout --tag latest
+  skopeo copy oci:./index-layout:latest docker://quay.io/example/index:latest`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			build.FromDir = args[0]
+			build.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := build.Run(ctx)
+			if err != nil {
+				fatal(build.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(build.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&build.OutputDir, "oci-layout", "", "Directory in which to write the OCI image layout")
+	cmd.Flags().StringVarP(&build.Tag, "tag", "t", "", "Reference name of the image in the OCI image layout")
+	cmd.Flags().StringToStringVarP(&build.ExtraLabels, "label", "l", nil, "Extra labels to set on the image, in the form key=value")
+	_ = cmd.MarkFlagRequired("oci-layout")
+	return cmd
+}
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/api/resource"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newCacheCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the persistent image cache",
+	}
+	cmd.AddCommand(
+		newCacheListCmd(opts),
+		newCachePruneCmd(opts),
+	)
+	return cmd
+}
+
+func newCacheListCmd(opts *globalOptions) *cobra.Command {
+	var (
+		list action.CacheList
+	)
+	cmd := &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the images in the cache",
+		Args:    cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			list.Dir = opts.Registry.CacheDir
+			list.JSON = opts.Output == outputJSON
+			list.Writer = os.Stdout
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			if err := list.Run(ctx); err != nil {
+				fatal(opts.log, err)
+			}
+		},
+	}
+	return cmd
+}
+
+func newCachePruneCmd(opts *globalOptions) *cobra.Command {
+	var (
+		prune action.CachePrune
+	)
+	cmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove images from the cache",
+		Long: `Remove images from the cache.
+
+Images unused for longer than --unused-for are removed first, after which the
+least recently used images are evicted until the cache fits in --max-size. If
+neither flag is set, all images are removed.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, _ []string) {
+			prune.Dir = opts.Registry.CacheDir
+			prune.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := prune.Run(ctx)
+			if err != nil {
+				fatal(prune.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(prune.Log, err)
+			}
+		},
+	}
+	cmd.Flags().Var(newSizeValue(&prune.MaxSize), "max-size", "Maximum size of the cache after pruning (e.g. 500Mi, 2Gi)")
+	cmd.Flags().DurationVar(&prune.UnusedFor, "unused-for", 0, "Remove images that have not been used for this long (e.g. 168h)")
+	return cmd
+}
+
+// sizeValue is a pflag.Value for sizes in bytes, expressed as Kubernetes
+// resource quantities.
+type sizeValue int64
+
+func newSizeValue(p *int64) *sizeValue {
+	return (*sizeValue)(p)
+}
+
+func (s *sizeValue) String() string {
+	if *s == 0 {
+		return "0"
+	}
+	return resource.NewQuantity(int64(*s), resource.BinarySI).String()
+}
+
+func (s *sizeValue) Set(val string) error {
+	q, err := resource.ParseQuantity(val)
+	if err != nil {
+		return err
+	}
+	*s = sizeValue(q.Value())
+	return nil
+}
+
+func (s *sizeValue) Type() string {
+	return "size"
+}
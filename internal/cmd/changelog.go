@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newChangelogCmd(opts *globalOptions) *cobra.Command {
+	var (
+		changelog action.Changelog
+	)
+	cmd := &cobra.Command{
+		Use:   "changelog <oldDcDir> <newDcDir>",
+		Short: "Generate Markdown release notes between two declarative config directories",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			changelog.OldDir = args[0]
+			changelog.NewDir = args[1]
+			changelog.JSON = opts.Output == outputJSON
+			changelog.Writer = os.Stdout
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			if err := changelog.Run(ctx); err != nil {
+				fatal(opts.log, err)
+			}
+		},
+	}
+	return cmd
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newChannelCmd(opts *globalOptions) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "channel",
+		Short: "Manage the channels of a declarative config directory",
+	}
+	cmd.AddCommand(
+		newChannelPromoteCmd(opts),
+		newChannelSetDefaultCmd(opts),
+		newChannelRenameCmd(opts),
+		newChannelRemoveCmd(opts),
+	)
+	return cmd
+}
+
+func newChannelPromoteCmd(opts *globalOptions) *cobra.Command {
+	var (
+		promote action.ChannelPromote
+	)
+	cmd := &cobra.Command{
+		Use:   "promote <dcDir> <bundle>",
+		Short: "Add an existing bundle and its replaces chain to another channel",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			promote.FromDir = args[0]
+			promote.LockTimeout = opts.LockTimeout
+			promote.Bundle = args[1]
+			promote.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := promote.Run(ctx)
+			if err != nil {
+				fatal(promote.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(promote.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&promote.ToChannel, "to", "", "Channel to promote the bundle to")
+	cmd.Flags().StringVar(&promote.FromChannel, "from", "", "Channel to copy the replaces chain from (required if the bundle is in multiple channels)")
+	_ = cmd.MarkFlagRequired("to")
+	return cmd
+}
+
+func newChannelSetDefaultCmd(opts *globalOptions) *cobra.Command {
+	var (
+		setDefault action.ChannelSetDefault
+	)
+	cmd := &cobra.Command{
+		Use:   "set-default <dcDir> <package> <channel>",
+		Short: "Set the default channel of a package",
+		Args:  cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			setDefault.FromDir = args[0]
+			setDefault.LockTimeout = opts.LockTimeout
+			setDefault.Package = args[1]
+			setDefault.Channel = args[2]
+			setDefault.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := setDefault.Run(ctx)
+			if err != nil {
+				fatal(setDefault.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(setDefault.Log, err)
+			}
+		},
+	}
+	return cmd
+}
+
+func newChannelRenameCmd(opts *globalOptions) *cobra.Command {
+	var (
+		rename action.ChannelRename
+	)
+	cmd := &cobra.Command{
+		Use:   "rename <dcDir> <package> <channel> <newName>",
+		Short: "Rename a channel of a package",
+		Args:  cobra.ExactArgs(4),
+		Run: func(cmd *cobra.Command, args []string) {
+			rename.FromDir = args[0]
+			rename.LockTimeout = opts.LockTimeout
+			rename.Package = args[1]
+			rename.Channel = args[2]
+			rename.NewName = args[3]
+			rename.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := rename.Run(ctx)
+			if err != nil {
+				fatal(rename.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(rename.Log, err)
+			}
+		},
+	}
+	return cmd
+}
+
+func newChannelRemoveCmd(opts *globalOptions) *cobra.Command {
+	var (
+		remove action.ChannelRemove
+	)
+	cmd := &cobra.Command{
+		Use:   "remove <dcDir> <package> <channel>",
+		Short: "Remove a channel from a package",
+		Args:  cobra.ExactArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			remove.FromDir = args[0]
+			remove.LockTimeout = opts.LockTimeout
+			remove.Package = args[1]
+			remove.Channel = args[2]
+			remove.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := remove.Run(ctx)
+			if err != nil {
+				fatal(remove.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(remove.Log, err)
+			}
+		},
+	}
+	return cmd
+}
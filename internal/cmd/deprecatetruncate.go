@@ -1,13 +1,12 @@
 package cmd
 
 import (
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/release-engineering/dcm/internal/action"
 )
 
-func newDeprecateTruncateCmd() *cobra.Command {
+func newDeprecateTruncateCmd(opts *globalOptions) *cobra.Command {
 	var (
 		dp action.DeprecateTruncate
 	)
@@ -17,11 +16,18 @@ func newDeprecateTruncateCmd() *cobra.Command {
 		Args:  cobra.MinimumNArgs(2),
 		Run: func(cmd *cobra.Command, args []string) {
 			dp.FromDir = args[0]
+			dp.LockTimeout = opts.LockTimeout
 			dp.BundleImages = args[1:]
-			dp.Log = logrus.New()
+			dp.Log = opts.log
 
-			if err := dp.Run(cmd.Context()); err != nil {
-				dp.Log.Fatal(err)
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := dp.Run(ctx)
+			if err != nil {
+				fatal(dp.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(dp.Log, err)
 			}
 		},
 	}
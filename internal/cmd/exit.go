@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+// Exit codes of dcm, by class of failure. Only ExitPull, ExitLocked and
+// ExitCatalogChanged denote failures that may succeed when retried.
+const (
+	ExitError          = 1
+	ExitUsage          = 2
+	ExitInvalidInput   = 3
+	ExitInvalidResult  = 4
+	ExitBundleExists   = 5
+	ExitBundleNotFound = 6
+	ExitOutputNotEmpty = 7
+	ExitPull           = 8
+	ExitLocked         = 9
+	ExitCatalogChanged = 10
+	ExitLintFailed     = 11
+	ExitInvalidBundle  = 12
+	// ExitInterrupted is returned when the command is canceled by SIGINT or
+	// SIGTERM.
+	ExitInterrupted = 130
+)
+
+var exitCodes = []struct {
+	class error
+	code  int
+}{
+	{context.Canceled, ExitInterrupted},
+	{action.ErrInvalidInput, ExitInvalidInput},
+	{action.ErrInvalidResult, ExitInvalidResult},
+	{action.ErrBundleExists, ExitBundleExists},
+	{action.ErrBundleNotFound, ExitBundleNotFound},
+	{action.ErrOutputNotEmpty, ExitOutputNotEmpty},
+	{action.ErrPull, ExitPull},
+	{action.ErrLocked, ExitLocked},
+	{action.ErrCatalogChanged, ExitCatalogChanged},
+	{action.ErrLintFailed, ExitLintFailed},
+	{action.ErrInvalidBundle, ExitInvalidBundle},
+}
+
+func exitCode(err error) int {
+	for _, c := range exitCodes {
+		if errors.Is(err, c.class) {
+			return c.code
+		}
+	}
+	return ExitError
+}
+
+// fatal logs err and exits with the exit code of its class.
+func fatal(log *logrus.Logger, err error) {
+	log.Log(logrus.FatalLevel, err)
+	log.Exit(exitCode(err))
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newExportSqliteCmd(opts *globalOptions) *cobra.Command {
+	var (
+		export action.ExportSqlite
+	)
+	cmd := &cobra.Command{
+		Use:   "export-sqlite <dcDir>",
+		Short: "Export a declarative config directory to a sqlite index database",
+		Long: `Export a declarative config directory to a sqlite index database.
+
+Bundles are loaded from the objects stored in the declarative config. Bundles
+without objects, such as bundles that are not channel heads, are pulled from
+their bundle image. Channel graphs are taken from the channel entries.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			export.FromDir = args[0]
+			export.RegistryOptions = opts.Registry
+			export.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := export.Run(ctx)
+			if err != nil {
+				fatal(export.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(export.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&export.OutputFile, "output-file", "o", "index.db", "Path of the sqlite index database to create")
+	return cmd
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newGenerateDockerfileCmd(opts *globalOptions) *cobra.Command {
+	var (
+		gen action.GenerateDockerfile
+	)
+	cmd := &cobra.Command{
+		Use:   "generate-dockerfile <dcDir>",
+		Short: "Generate a Dockerfile to build an index image from a declarative config directory",
+		Long: `Generate a Dockerfile to build an index image from a declarative config directory.
+
+The Dockerfile is written next to the directory, as <dcDir>.Dockerfile, and
+must be built with the parent of the directory as its context. A
+<dcDir>.Dockerfile.dockerignore file is written along with it, to keep the
+catalog lock file out of the image. Existing files are only replaced with
+--overwrite.`,
+		Example: `  dcm generate-dockerfile ./catalog
+  podman build -f catalog.Dockerfile -t quay.io/example/index:latest .`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			gen.FromDir = args[0]
+			gen.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := gen.Run(ctx)
+			if err != nil {
+				fatal(gen.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(gen.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&gen.BaseImage, "base-image", "i", "quay.io/operator-framework/opm:latest", "Image in which to build the index, containing /bin/opm")
+	cmd.Flags().StringToStringVarP(&gen.ExtraLabels, "label", "l", nil, "Extra labels to set on the image, in the form key=value")
+	cmd.Flags().BoolVar(&gen.Overwrite, "overwrite", false, "Replace an existing Dockerfile")
+	return cmd
+}
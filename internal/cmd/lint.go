@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newLintCmd(opts *globalOptions) *cobra.Command {
+	var (
+		lint       action.Lint
+		configFile string
+	)
+	cmd := &cobra.Command{
+		Use:   "lint <dcDir>",
+		Short: "Check a declarative config directory against catalog policies",
+		Long: `Check a declarative config directory against catalog policies that go beyond
+OLM validity. The built-in rules are:
+
+  channel-name:        channel names match a pattern (stable, fast or candidate-* by default)
+  head-bundle-objects: channel heads carry their olm.bundle.object properties
+  no-latest-tag:       images are not referenced by the latest tag, explicitly or implicitly
+  pinned-images:       bundle images and related images are referenced by digest
+
+Every rule has severity error by default. The severity of each rule, one of
+error, warning, note or off, and the pattern of the channel-name rule can be
+set in a configuration file. The command exits with code 11 if any finding
+has severity error.`,
+		Example: `  cat > lint.yaml <<EOF
+  rules:
+    channel-name:
+      severity: warning
+      pattern: '^(stable|fast|candidate-v[0-9.]+)$'
+    head-bundle-objects:
+      severity: off
+  EOF
+  dcm lint ./catalog --config lint.yaml --format sarif > lint.sarif`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			lint.FromDir = args[0]
+			lint.Writer = os.Stdout
+			if configFile != "" {
+				c, err := action.LoadLintConfig(configFile)
+				if err != nil {
+					fatal(opts.log, err)
+				}
+				lint.Config = *c
+			}
+			if lint.Format == "" && opts.Output == outputJSON {
+				lint.Format = action.LintFormatJSON
+			}
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			if err := lint.Run(ctx); err != nil {
+				fatal(opts.log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&configFile, "config", "", "Lint configuration file setting the severity and options of the rules")
+	cmd.Flags().StringVar((*string)(&lint.Format), "format", "", "Format of the report: text, json or sarif (defaults to json with --output json, and text otherwise)")
+	return cmd
+}
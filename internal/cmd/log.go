@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+)
+
+// setupLogging creates the logger shared by all actions from the log flags.
+// Warnings logged to it are recorded, to be included in the command's
+// result.
+func (o *globalOptions) setupLogging() error {
+	level, err := logrus.ParseLevel(o.LogLevel)
+	if err != nil {
+		return fmt.Errorf("invalid log level %q: %w", o.LogLevel, err)
+	}
+	var formatter logrus.Formatter
+	switch o.LogFormat {
+	case logFormatText:
+		formatter = &logrus.TextFormatter{}
+	case logFormatJSON:
+		formatter = &logrus.JSONFormatter{}
+	default:
+		return fmt.Errorf("invalid log format %q: expected %s or %s", o.LogFormat, logFormatText, logFormatJSON)
+	}
+
+	o.log = logrus.New()
+	o.log.SetOutput(os.Stderr)
+	o.log.SetLevel(level)
+	o.log.SetFormatter(formatter)
+	o.warnings = &warningHook{}
+	o.log.AddHook(o.warnings)
+
+	// Libraries such as operator-registry log to the global logger. Their
+	// messages are only useful when debugging, so the global logger stays
+	// silenced at lower levels.
+	if level >= logrus.DebugLevel {
+		std := logrus.StandardLogger()
+		std.SetOutput(os.Stderr)
+		std.SetLevel(level)
+		std.SetFormatter(formatter)
+	}
+	return nil
+}
+
+// usageLogger returns the logger of the log flags, to log invalid flags or
+// arguments with. The flags may not have been parsed, or be invalid
+// themselves, in which case a default logger is returned.
+func (o *globalOptions) usageLogger() *logrus.Logger {
+	if o.log == nil && o.setupLogging() != nil {
+		return logrus.New()
+	}
+	return o.log
+}
@@ -2,13 +2,12 @@ package cmd
 
 import (
 	"github.com/operator-framework/operator-registry/alpha/declcfg"
-	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 
 	"github.com/release-engineering/dcm/internal/action"
 )
 
-func newMigrateCmd() *cobra.Command {
+func newMigrateCmd(opts *globalOptions) *cobra.Command {
 	var (
 		migrate action.Migrate
 	)
@@ -19,9 +18,17 @@ func newMigrateCmd() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			migrate.IndexImage = args[0]
 			migrate.WriteFunc = declcfg.WriteYAML
+			migrate.RegistryOptions = opts.Registry
+			migrate.Log = opts.log
 
-			if err := migrate.Run(cmd.Context()); err != nil {
-				logrus.New().Fatal(err)
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := migrate.Run(ctx)
+			if err != nil {
+				fatal(migrate.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(migrate.Log, err)
 			}
 			return nil
 		},
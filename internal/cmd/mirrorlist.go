@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newMirrorListCmd(opts *globalOptions) *cobra.Command {
+	var (
+		mirrorList action.MirrorList
+	)
+	cmd := &cobra.Command{
+		Use:   "mirror-list <dcDir>",
+		Short: "Generate image mirroring manifests for the images of a declarative config directory",
+		Long: `Generate image mirroring manifests for the images of a declarative config directory.
+
+The output directory receives a mapping file for "oc image mirror", along with
+ImageContentSourcePolicy and ImageDigestMirrorSet manifests that redirect the
+source repositories to the target registry.`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			mirrorList.FromDir = args[0]
+			mirrorList.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := mirrorList.Run(ctx)
+			if err != nil {
+				fatal(mirrorList.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(mirrorList.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVar(&mirrorList.TargetRegistry, "target-registry", "", "Registry (and optional namespace) to mirror the images to")
+	cmd.Flags().StringVarP(&mirrorList.OutputDir, "output-dir", "d", "mirror", "Directory in which to write the mirroring manifests")
+	cmd.Flags().StringVar(&mirrorList.Name, "name", "dcm-catalog", "Name of the generated ImageContentSourcePolicy and ImageDigestMirrorSet")
+	cmd.Flags().StringSliceVar(&mirrorList.Packages, "packages", nil, "Only include images of bundles in these packages")
+	cmd.Flags().StringSliceVar(&mirrorList.Channels, "channels", nil, "Only include images of bundles in these channels")
+	cmd.Flags().BoolVar(&mirrorList.HeadsOnly, "heads-only", false, "Only include images of channel heads")
+	_ = cmd.MarkFlagRequired("target-registry")
+	return cmd
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+func validateOutput(output string) error {
+	switch output {
+	case outputText, outputJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid output format %q: expected %s or %s", output, outputText, outputJSON)
+}
+
+// printResult writes the result of a command to stdout when JSON output is
+// requested. In text output, the command's logs already describe what it did.
+func (o *globalOptions) printResult(res *action.Result) error {
+	if o.Output != outputJSON {
+		return nil
+	}
+	if res == nil {
+		res = &action.Result{}
+	}
+	if o.warnings != nil {
+		res.Warnings = append(res.Warnings, o.warnings.warnings...)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(res)
+}
+
+// warningHook is a logrus hook that records the messages of warnings.
+type warningHook struct {
+	warnings []string
+}
+
+func (h *warningHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.WarnLevel}
+}
+
+func (h *warningHook) Fire(entry *logrus.Entry) error {
+	h.warnings = append(h.warnings, entry.Message)
+	return nil
+}
@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newPinCmd(opts *globalOptions) *cobra.Command {
+	var (
+		pin action.Pin
+	)
+	cmd := &cobra.Command{
+		Use:   "pin <dcDir>",
+		Short: "Resolve all bundle images and related images of a declarative config directory to digests",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			pin.FromDir = args[0]
+			pin.LockTimeout = opts.LockTimeout
+			pin.RegistryOptions = opts.Registry
+			pin.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := pin.Run(ctx)
+			if err != nil {
+				fatal(pin.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(pin.Log, err)
+			}
+		},
+	}
+	return cmd
+}
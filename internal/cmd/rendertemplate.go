@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newRenderTemplateCmd(opts *globalOptions) *cobra.Command {
+	var (
+		render action.RenderTemplate
+	)
+	cmd := &cobra.Command{
+		Use:   "render-template <template>",
+		Short: "Render a complete declarative config directory from a template",
+		Long: `Render a complete declarative config directory from a template.
+
+The template lists the bundle images of each package. Channels may be
+overridden for a whole package or for individual bundles, and the default
+channel for a package. The channel graphs are built from the bundles'
+replaces, skips and skipRange, in the same way as the add command.`,
+		Example: `  cat > template.yaml <<EOF
+  packages:
+  - name: foo
+    defaultChannel: stable
+    bundles:
+    - image: quay.io/example/foo-bundle:v0.1.0
+    - image: quay.io/example/foo-bundle:v0.2.0
+      channels: [stable, fast]
+  EOF
+  dcm render-template template.yaml -o ./catalog`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			render.RegistryOptions = opts.Registry
+			render.LockTimeout = opts.LockTimeout
+			render.Log = opts.log
+
+			template, err := action.LoadTemplate(args[0])
+			if err != nil {
+				fatal(render.Log, err)
+			}
+			render.Template = *template
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := render.Run(ctx)
+			if err != nil {
+				fatal(render.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(render.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&render.OutputDir, "output-dir", "o", "", "Directory in which to write the rendered declarative config")
+	cmd.Flags().BoolVar(&render.Overwrite, "overwrite", false, "Replace the file-based catalog in a non-empty output directory")
+	cmd.Flags().StringSliceVar(&render.Validators, "validators", action.DefaultValidators, "Validators run on the bundles: any of format, csv, crd, bundle, versions, operatorhub and bundle-objects")
+	cmd.Flags().BoolVar(&render.SkipValidation, "skip-validation", false, "Do not validate the bundles")
+	_ = cmd.MarkFlagRequired("output-dir")
+	return cmd
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newRewriteImagesCmd(opts *globalOptions) *cobra.Command {
+	var (
+		rewrite  action.RewriteImages
+		mappings []string
+	)
+	cmd := &cobra.Command{
+		Use:   "rewrite-images <dcDir>",
+		Short: "Rewrite image references of a declarative config directory",
+		Long: `Rewrite image references of a declarative config directory.
+
+Every bundle image and related image starting with the prefix of a mapping is
+rewritten to start with the mapping's replacement instead. When several
+mappings match, the one with the longest prefix is used.`,
+		Example: `  dcm rewrite-images ./catalog --map registry.stage.example.com/=registry.example.com/`,
+		Args:    cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			rewrite.FromDir = args[0]
+			rewrite.LockTimeout = opts.LockTimeout
+			rewrite.Log = opts.log
+
+			for _, m := range mappings {
+				split := strings.SplitN(m, "=", 2)
+				if len(split) != 2 || split[0] == "" {
+					fatal(rewrite.Log, fmt.Errorf("invalid mapping %q: expected <from-prefix>=<to-prefix>", m))
+				}
+				rewrite.Mappings = append(rewrite.Mappings, action.ImageMapping{From: split[0], To: split[1]})
+			}
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := rewrite.Run(ctx)
+			if err != nil {
+				fatal(rewrite.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(rewrite.Log, err)
+			}
+		},
+	}
+	cmd.Flags().StringArrayVar(&mappings, "map", nil, "Image prefix mapping in the form <from-prefix>=<to-prefix> (can be specified multiple times)")
+	cmd.Flags().BoolVar(&rewrite.RewriteObjects, "rewrite-objects", false, "Also rewrite image references inside bundle objects, such as the CSV")
+	_ = cmd.MarkFlagRequired("map")
+	return cmd
+}
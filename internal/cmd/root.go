@@ -1,18 +1,115 @@
 package cmd
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
 )
 
-func Run() error {
+// globalOptions holds the values of the persistent flags shared by all
+// subcommands.
+type globalOptions struct {
+	Registry action.RegistryOptions
+	// Output is the format of the command results, text or json.
+	Output    string
+	LogLevel  string
+	LogFormat string
+	// Timeout bounds the run time of a command. Zero means no limit.
+	Timeout time.Duration
+	// LockTimeout is the maximum time to wait for the lock of a declarative
+	// config directory modified by a command.
+	LockTimeout time.Duration
+
+	// log is the logger shared by all actions, set up from the log flags
+	// before any subcommand runs.
+	log      *logrus.Logger
+	warnings *warningHook
+}
+
+// Run runs the dcm command. Failures of the commands exit by themselves, with
+// the exit code of their class; invalid flags or arguments are logged here
+// and exit with ExitUsage.
+func Run() {
+	var opts globalOptions
 	root := cobra.Command{
 		Use: "dcm",
+		// Errors are logged by Run, once.
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, _ []string) error {
+			if err := opts.setupLogging(); err != nil {
+				return err
+			}
+			if err := validateOutput(opts.Output); err != nil {
+				return err
+			}
+			// The flags and arguments are valid: later errors are not
+			// usage errors.
+			cmd.SilenceUsage = true
+			return nil
+		},
 	}
+	root.PersistentFlags().StringVar(&opts.LogLevel, "log-level", logrus.InfoLevel.String(), "Log level: one of panic, fatal, error, warn, info, debug or trace")
+	root.PersistentFlags().StringVar(&opts.LogFormat, "log-format", logFormatText, "Log format: text or json (logs are written to stderr)")
+	root.PersistentFlags().DurationVar(&opts.Timeout, "timeout", 0, "Maximum run time of the command, e.g. 30m (0 means no limit; does not apply to serve)")
+	root.PersistentFlags().DurationVar(&opts.LockTimeout, "lock-timeout", 5*time.Minute, "Maximum time to wait for another dcm process to release the lock of the declarative config directory (0 fails at once)")
+	root.PersistentFlags().StringVar(&opts.Output, "output", outputText, "Output format of the command results: text or json (json writes a result object to stdout)")
+	root.PersistentFlags().StringVar((*string)(&opts.Registry.ContainerTool), "container-tool", string(action.ContainerToolNone), "Tool used to pull images: one of none, containerd, podman or docker (none uses the built-in containerd client)")
+	root.PersistentFlags().StringVar(&opts.Registry.AuthFile, "auth-file", "", "Path of the registry authentication file (defaults to the docker config)")
+	root.PersistentFlags().StringVar(&opts.Registry.CAFile, "ca-file", "", "Path of a PEM bundle of additional certificate authorities to trust when pulling images")
+	root.PersistentFlags().BoolVar(&opts.Registry.SkipTLSVerify, "skip-tls-verify", false, "Skip TLS certificate verification when pulling images")
+	root.PersistentFlags().BoolVar(&opts.Registry.UseHTTP, "use-http", false, "Use plain HTTP when pulling images")
+	root.PersistentFlags().StringVar(&opts.Registry.CacheDir, "cache-dir", "", "Directory of a persistent image cache shared across invocations (defaults to a temporary cache)")
+	root.PersistentFlags().DurationVar(&opts.Registry.PullTimeout, "pull-timeout", 10*time.Minute, "Maximum time of a single attempt to pull an image (0 means no limit)")
+	root.PersistentFlags().IntVar(&opts.Registry.PullRetries, "pull-retries", 3, "Number of times a failed image pull is retried, with exponential backoff")
+	root.PersistentFlags().Var(newSizeValue(&opts.Registry.CacheMaxSize), "cache-max-size", "Maximum size of the persistent image cache, evicting the least recently used images (e.g. 10Gi, defaults to unlimited)")
+
 	root.AddCommand(
-		newAddCmd(),
-		newDeprecateTruncateCmd(),
-		newMigrateCmd(),
-		newVersionCmd(),
+		newAddCmd(&opts),
+		newApplyCmd(&opts),
+		newBuildCmd(&opts),
+		newCacheCmd(&opts),
+		newChangelogCmd(&opts),
+		newChannelCmd(&opts),
+		newDeprecateTruncateCmd(&opts),
+		newExportSqliteCmd(&opts),
+		newGenerateDockerfileCmd(&opts),
+		newLintCmd(&opts),
+		newMigrateCmd(&opts),
+		newMirrorListCmd(&opts),
+		newPinCmd(&opts),
+		newRenderTemplateCmd(&opts),
+		newRewriteImagesCmd(&opts),
+		newServeCmd(&opts),
+		newUpdateBundleCmd(&opts),
+		newVersionCmd(&opts),
 	)
-	return root.Execute()
+
+	// The first SIGINT or SIGTERM cancels the running command, which then
+	// cleans up its temporary files. A second one terminates dcm at once.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	if err := root.ExecuteContext(ctx); err != nil {
+		opts.usageLogger().Log(logrus.FatalLevel, err)
+		stop()
+		os.Exit(ExitUsage)
+	}
+}
+
+// context returns the context of cmd, bounded by the --timeout flag.
+func (o *globalOptions) context(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	if o.Timeout > 0 {
+		return context.WithTimeout(cmd.Context(), o.Timeout)
+	}
+	return context.WithCancel(cmd.Context())
 }
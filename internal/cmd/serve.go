@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newServeCmd(opts *globalOptions) *cobra.Command {
+	var (
+		serve action.Serve
+	)
+	cmd := &cobra.Command{
+		Use:   "serve <dcDir>",
+		Short: "Serve a declarative config directory over the operator-registry gRPC API",
+		Long: `Serve a declarative config directory over the operator-registry gRPC API.
+
+The directory is checked for changes periodically and reloaded when it
+changes. If the changed catalog is invalid, the previous one keeps being
+served.`,
+		Example: `  dcm serve ./catalog --port 50051
+  grpcurl -plaintext localhost:50051 api.Registry/ListPackages`,
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			serve.FromDir = args[0]
+			serve.Log = opts.log
+
+			if err := serve.Run(cmd.Context()); err != nil {
+				fatal(serve.Log, err)
+			}
+		},
+	}
+	cmd.Flags().IntVarP(&serve.Port, "port", "p", 50051, "Port number to serve on")
+	cmd.Flags().DurationVar(&serve.ReloadInterval, "reload-interval", 2*time.Second, "Interval at which to check the directory for changes (0 disables reloading)")
+	return cmd
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/release-engineering/dcm/internal/action"
+)
+
+func newUpdateBundleCmd(opts *globalOptions) *cobra.Command {
+	var (
+		update action.UpdateBundle
+	)
+	cmd := &cobra.Command{
+		Use:   "update-bundle <dcDir> <bundleImage> [<bundleImage>...]",
+		Short: "Refresh the payload of existing bundles in a declarative config directory, keeping their channel entries",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			update.FromDir = args[0]
+			update.LockTimeout = opts.LockTimeout
+			update.BundleImages = args[1:]
+			update.RegistryOptions = opts.Registry
+			update.Log = opts.log
+
+			ctx, cancel := opts.context(cmd)
+			defer cancel()
+			res, err := update.Run(ctx)
+			if err != nil {
+				fatal(update.Log, err)
+			}
+			if err := opts.printResult(res); err != nil {
+				fatal(update.Log, err)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&update.PinDigests, "pin-digests", false, "Resolve the bundle images and related images of the updated bundles to digests")
+	return cmd
+}
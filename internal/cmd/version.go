@@ -1,19 +1,27 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 
 	"github.com/release-engineering/dcm/internal/version"
 )
 
-func newVersionCmd() *cobra.Command {
+func newVersionCmd(opts *globalOptions) *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "version",
 		Short: "Print version information",
-		Run: func(_ *cobra.Command, _ []string) {
+		RunE: func(_ *cobra.Command, _ []string) error {
+			if opts.Output == outputJSON {
+				enc := json.NewEncoder(os.Stdout)
+				enc.SetIndent("", "  ")
+				return enc.Encode(version.Version)
+			}
 			fmt.Printf("%#v\n", version.Version)
+			return nil
 		},
 	}
 	return cmd
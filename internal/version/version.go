@@ -16,13 +16,13 @@ var (
 )
 
 type Info struct {
-	GitVersion    string
-	GitCommit     string
-	GitCommitTime string
-	GitTreeState  string
-	GoVersion     string
-	Compiler      string
-	Platform      string
+	GitVersion    string `json:"gitVersion"`
+	GitCommit     string `json:"gitCommit"`
+	GitCommitTime string `json:"gitCommitTime"`
+	GitTreeState  string `json:"gitTreeState"`
+	GoVersion     string `json:"goVersion"`
+	Compiler      string `json:"compiler"`
+	Platform      string `json:"platform"`
 }
 
 var Version Info
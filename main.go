@@ -9,10 +9,9 @@ import (
 )
 
 func main() {
-	// Silence the global logger
+	// Silence the global logger, which libraries log to, unless debug logging
+	// is enabled by the log flags.
 	logrus.SetOutput(ioutil.Discard)
 
-	if err := cmd.Run(); err != nil {
-		logrus.New().Fatal(err)
-	}
+	cmd.Run()
 }